@@ -0,0 +1,189 @@
+package analytics
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dantdj/goreel/database"
+)
+
+// Store is where the recorder writes its batches. It's satisfied by *database.DB.
+type Store interface {
+	RecordVideoStats(ctx context.Context, views []database.ViewEvent, watch []database.WatchTime, window time.Duration) error
+}
+
+type viewKey struct {
+	videoId string
+	viewer  string
+}
+
+type watchKey struct {
+	videoId string
+	day     time.Time
+}
+
+// Recorder buffers playback views and watch time in memory, and writes them to
+// the store in batches. Repeat views and heartbeats for the same video collapse
+// into one row per batch, so a popular video costs a handful of writes per
+// flush rather than one per viewer request.
+type Recorder struct {
+	store    Store
+	window   time.Duration
+	interval time.Duration
+	// Number of pending entries that triggers an early flush. Past ten times
+	// this, new events are dropped until a flush succeeds.
+	maxPending int
+
+	mu    sync.Mutex
+	views map[viewKey]time.Time
+	watch map[watchKey]float64
+	// When each viewer last reported watch time, so they can't be credited
+	// with more than has actually passed
+	heartbeats map[viewKey]time.Time
+	full       chan struct{}
+}
+
+// Creates a recorder that counts at most one view per viewer per video within
+// the window, and flushes to the store every interval.
+func NewRecorder(store Store, window, interval time.Duration) *Recorder {
+	return &Recorder{
+		store:      store,
+		window:     window,
+		interval:   interval,
+		maxPending: 10_000,
+		views:      map[viewKey]time.Time{},
+		watch:      map[watchKey]float64{},
+		heartbeats: map[viewKey]time.Time{},
+		full:       make(chan struct{}, 1),
+	}
+}
+
+// Queues a view of a video by a viewer.
+func (r *Recorder) RecordView(videoId, viewer string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := viewKey{videoId, viewer}
+	if first, ok := r.views[key]; ok && !at.Before(first) {
+		return
+	}
+	if !r.accept() {
+		return
+	}
+	r.views[key] = at
+}
+
+// Queues time spent watching a video by a viewer. After the viewer's first
+// report, they're credited with no more than the time since their last one,
+// however many seconds they claim.
+func (r *Recorder) RecordWatchTime(videoId, viewer string, seconds float64, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	viewerKey := viewKey{videoId, viewer}
+	if last, ok := r.heartbeats[viewerKey]; ok {
+		if !at.After(last) {
+			return
+		}
+		seconds = min(seconds, at.Sub(last).Seconds())
+	} else if len(r.heartbeats) >= 10*r.maxPending {
+		slog.Warn("Dropping watch time, too many viewers", slog.Int("viewers", len(r.heartbeats)))
+		return
+	}
+	r.heartbeats[viewerKey] = at
+
+	key := watchKey{videoId, at.UTC().Truncate(24 * time.Hour)}
+	if _, ok := r.watch[key]; !ok && !r.accept() {
+		return
+	}
+	r.watch[key] += seconds
+}
+
+// Reports whether there's room for a new pending entry, asking for an early
+// flush once the buffer is filling up. Must be called with the lock held.
+func (r *Recorder) accept() bool {
+	pending := len(r.views) + len(r.watch)
+	if pending >= r.maxPending {
+		select {
+		case r.full <- struct{}{}:
+		default:
+		}
+	}
+	if pending >= 10*r.maxPending {
+		slog.Warn("Dropping playback stats, too many pending", slog.Int("pending", pending))
+		return false
+	}
+	return true
+}
+
+// Flushes pending stats every interval, or sooner if the buffer fills up, until
+// the context is cancelled. Anything still pending is then flushed one last time.
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := r.Flush(flushCtx); err != nil {
+				slog.Error("Failed to flush playback stats on shutdown", slog.String("error", err.Error()))
+			}
+			return
+		case <-ticker.C:
+		case <-r.full:
+		}
+
+		if err := r.Flush(ctx); err != nil {
+			slog.Error("Failed to flush playback stats", slog.String("error", err.Error()))
+		}
+	}
+}
+
+// Writes everything pending to the store. If the write fails, the stats are
+// put back to be retried on the next flush.
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	pendingViews, pendingWatch := r.views, r.watch
+	r.views, r.watch = map[viewKey]time.Time{}, map[watchKey]float64{}
+	// Viewers quiet for longer than the window have most likely stopped watching
+	for key, last := range r.heartbeats {
+		if time.Since(last) > r.window {
+			delete(r.heartbeats, key)
+		}
+	}
+	r.mu.Unlock()
+
+	if len(pendingViews) == 0 && len(pendingWatch) == 0 {
+		return nil
+	}
+
+	views := make([]database.ViewEvent, 0, len(pendingViews))
+	for key, at := range pendingViews {
+		views = append(views, database.ViewEvent{VideoID: key.videoId, Viewer: key.viewer, At: at})
+	}
+	watch := make([]database.WatchTime, 0, len(pendingWatch))
+	for key, seconds := range pendingWatch {
+		watch = append(watch, database.WatchTime{VideoID: key.videoId, Day: key.day, Seconds: seconds})
+	}
+
+	if err := r.store.RecordVideoStats(ctx, views, watch, r.window); err != nil {
+		r.mu.Lock()
+		for key, at := range pendingViews {
+			if first, ok := r.views[key]; !ok || at.Before(first) {
+				r.views[key] = at
+			}
+		}
+		for key, seconds := range pendingWatch {
+			r.watch[key] += seconds
+		}
+		r.mu.Unlock()
+		return err
+	}
+
+	slog.Debug("Flushed playback stats", slog.Int("views", len(views)), slog.Int("watch_times", len(watch)))
+	return nil
+}
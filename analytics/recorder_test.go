@@ -0,0 +1,101 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dantdj/goreel/database"
+)
+
+type fakeStore struct {
+	views []database.ViewEvent
+	watch []database.WatchTime
+	err   error
+}
+
+func (s *fakeStore) RecordVideoStats(ctx context.Context, views []database.ViewEvent, watch []database.WatchTime, window time.Duration) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.views = append(s.views, views...)
+	s.watch = append(s.watch, watch...)
+	return nil
+}
+
+func TestRecorder_Flush(t *testing.T) {
+	store := &fakeStore{}
+	r := NewRecorder(store, 30*time.Minute, time.Minute)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	r.RecordView("abc", "viewer-1", now.Add(time.Second))
+	r.RecordView("abc", "viewer-1", now)
+	r.RecordView("abc", "viewer-2", now)
+	r.RecordWatchTime("abc", "viewer-1", 10, now)
+	r.RecordWatchTime("abc", "viewer-2", 5, now.Add(time.Hour))
+
+	if err := r.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(store.views) != 2 {
+		t.Fatalf("expected 2 views, got %d", len(store.views))
+	}
+	for _, v := range store.views {
+		if v.Viewer == "viewer-1" && !v.At.Equal(now) {
+			t.Errorf("expected the earliest view to be kept, got %v", v.At)
+		}
+	}
+	if len(store.watch) != 1 || store.watch[0].Seconds != 15 {
+		t.Fatalf("expected 15 seconds of watch time in one row, got %+v", store.watch)
+	}
+	if want := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC); !store.watch[0].Day.Equal(want) {
+		t.Errorf("expected day %v, got %v", want, store.watch[0].Day)
+	}
+}
+
+func TestRecorder_FlushRetriesOnError(t *testing.T) {
+	store := &fakeStore{err: errors.New("database unavailable")}
+	r := NewRecorder(store, 30*time.Minute, time.Minute)
+	now := time.Now()
+
+	r.RecordView("abc", "viewer-1", now)
+	r.RecordWatchTime("abc", "viewer-1", 10, now)
+	if err := r.Flush(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	r.RecordWatchTime("abc", "viewer-1", 5, now.Add(5*time.Second))
+	store.err = nil
+	if err := r.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(store.views) != 1 {
+		t.Errorf("expected the view to be retried, got %d views", len(store.views))
+	}
+	if len(store.watch) != 1 || store.watch[0].Seconds != 15 {
+		t.Errorf("expected 15 seconds of watch time, got %+v", store.watch)
+	}
+}
+
+func TestRecorder_WatchTimeCappedAtElapsed(t *testing.T) {
+	store := &fakeStore{}
+	r := NewRecorder(store, 30*time.Minute, time.Minute)
+	now := time.Now()
+
+	r.RecordWatchTime("abc", "viewer-1", 60, now)
+	// Claims a minute each time, but only a second has passed between each
+	for i := 1; i <= 10; i++ {
+		r.RecordWatchTime("abc", "viewer-1", 60, now.Add(time.Duration(i)*time.Second))
+	}
+	// Replayed and out of order heartbeats aren't credited at all
+	r.RecordWatchTime("abc", "viewer-1", 60, now)
+
+	if err := r.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(store.watch) != 1 || store.watch[0].Seconds != 70 {
+		t.Errorf("expected 70 seconds of watch time, got %+v", store.watch)
+	}
+}
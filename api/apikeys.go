@@ -0,0 +1,109 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dantdj/goreel/auth"
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+)
+
+// Issues a new API key. Expects a JSON body with a "name" and a list of
+// "scopes". The key is only ever returned in this response.
+func (app *Application) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	var input struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	if err := readJSON(w, r, &input); err != nil {
+		badRequestResponse(w, err.Error())
+		return
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	switch {
+	case input.Name == "":
+		badRequestResponse(w, "name is required")
+		return
+	case len(input.Name) > 100:
+		badRequestResponse(w, "name must not be more than 100 characters long")
+		return
+	case len(input.Scopes) == 0:
+		badRequestResponse(w, "at least one scope is required")
+		return
+	case !auth.ValidScopes(input.Scopes):
+		badRequestResponse(w, fmt.Sprintf("scopes must be one of %v", auth.Scopes))
+		return
+	}
+
+	key, err := auth.NewAPIKey()
+	if err != nil {
+		logger.Error("Failed to generate API key", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	prefix := key[:len(auth.APIKeyPrefix)+6]
+	apiKey, err := app.DB.CreateAPIKey(r.Context(), input.Name, prefix, auth.HashAPIKey(key), input.Scopes)
+	if err != nil {
+		logger.Error("Failed to record API key", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	logger.Info("Issued API key", slog.Int64("api_key_id", apiKey.ID), slog.String("name", apiKey.Name))
+
+	if err := writeJSON(w, http.StatusCreated, envelope{"api_key": apiKey, "key": key}, nil); err != nil {
+		logger.Error("Failed to return API key", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Lists all API keys, without the keys themselves.
+func (app *Application) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	keys, err := app.DB.ListAPIKeys(r.Context())
+	if err != nil {
+		logger.Error("Failed to list API keys", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	if err := writeJSON(w, http.StatusOK, envelope{"api_keys": keys}, nil); err != nil {
+		logger.Error("Failed to return API keys", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Revokes an API key, which takes effect on its next use.
+func (app *Application) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id, err := strconv.ParseInt(routeParam(r, "id"), 10, 64)
+	if err != nil || id < 1 {
+		notFoundResponse(w, r)
+		return
+	}
+
+	err = app.DB.RevokeAPIKey(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		notFoundResponse(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to revoke API key", slog.Int64("api_key_id", id), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	logger.Info("Revoked API key", slog.Int64("api_key_id", id))
+	w.WriteHeader(http.StatusNoContent)
+}
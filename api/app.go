@@ -1,64 +1,206 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
-	"os"
+	"time"
 
+	"github.com/dantdj/goreel/analytics"
+	"github.com/dantdj/goreel/auth"
+	"github.com/dantdj/goreel/config"
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+	"github.com/dantdj/goreel/moderation"
 	"github.com/dantdj/goreel/queueing"
 	"github.com/dantdj/goreel/storage"
 	"github.com/dantdj/goreel/video"
 )
 
 type Application struct {
+	Config *config.Config
+	// Which of ModeServe, ModeWorker or ModeAll the application is running in
+	Mode         string
+	DB           *database.DB
 	Storage      storage.Service
 	RabbitClient *queueing.Client
 	Processor    *video.Processor
+	// Nil when no OIDC provider is configured, which disables logins
+	OIDC *auth.OIDC
+	// Secret that bearer JWTs are signed with. Nil disables JWTs, leaving API keys.
+	JWTSecret []byte
+	// Signs temporary playback URLs. Nil disables signed URLs.
+	URLSigner *auth.URLSigner
+	// Buffers playback stats and writes them in batches
+	Stats *analytics.Recorder
+	// Comments containing these words are held for review
+	BannedWords *moderation.Filter
+	// Log levels adjustable at runtime. Nil disables the log level endpoints.
+	LogLevels *logging.Levels
 }
 
-func NewApplication() *Application {
-	// Storage account setup
-	storageAccountName := os.Getenv("AZURE_STORAGE_ACCOUNT_NAME")
-	if storageAccountName == "" {
-		storageAccountName = "goreelstorage"
+func NewApplication(cfg *config.Config) *Application {
+	// Database setup
+	db, err := database.Open(context.Background(), cfg.Database.URL.Value())
+	if err != nil {
+		slog.Error("Failed to connect to database", slog.String("error", err.Error()))
+		panic("couldn't connect to database")
 	}
-	containerName := os.Getenv("AZURE_STORAGE_CONTAINER_NAME")
-	if containerName == "" {
-		containerName = "videos"
+
+	if err := db.Migrate(context.Background()); err != nil {
+		slog.Error("Failed to migrate database", slog.String("error", err.Error()))
+		panic("couldn't migrate database")
 	}
-	storageClient := storage.NewAzureBlobStorage(os.Getenv("AZURE_STORAGE_CONNECTION_STRING"), storageAccountName, containerName)
+
+	// Storage account setup
+	storageClient := storage.NewInstrumented(storage.NewAzureBlobStorage(cfg.Storage.ConnectionString.Value(), cfg.Storage.AccountName, cfg.Storage.Container), "azure")
 
 	// RabbitMQ setup
-	rabbitUrl := os.Getenv("RABBITMQ_URL")
-	rabbitClient, err := queueing.NewRabbitClient(rabbitUrl)
+	rabbitClient, err := queueing.NewRabbitClient(cfg.Queue.URL.Value(), cfg.Queue.Prefetch)
 	if err != nil {
 		slog.Error("Failed to create RabbitMQ client", slog.String("error", err.Error()))
 		panic("couldn't set up RabbitMQ client")
 	}
 
-	if err := rabbitClient.EnsureQueue("video_processing"); err != nil {
+	if err := rabbitClient.EnsureQueue(cfg.Queue.Name); err != nil {
 		slog.Error("Failed to ensure queue", slog.String("error", err.Error()))
 		panic("couldn't ensure queue existed")
 	}
 
 	// Video processor setup
-	processor := video.NewProcessor(storageClient)
+	profiles, err := video.LoadProfiles(cfg.Video.ProfilesFile)
+	if err != nil {
+		slog.Error("Failed to load encoding profiles", slog.String("error", err.Error()))
+		panic("couldn't load encoding profiles")
+	}
+	processor := video.NewProcessor(storageClient, db, profiles, cfg.Video.TempDir)
+
+	// Login setup
+	var oidcClient *auth.OIDC
+	if cfg.Auth.OIDCIssuerURL != "" {
+		oidcClient, err = auth.NewOIDC(context.Background(), cfg.Auth.OIDCIssuerURL,
+			cfg.Auth.OIDCClientID, cfg.Auth.OIDCClientSecret.Value(), cfg.Auth.OIDCRedirectURL)
+		if err != nil {
+			slog.Error("Failed to set up OIDC provider", slog.String("error", err.Error()))
+			panic("couldn't set up OIDC provider")
+		}
+	} else {
+		slog.Info("OIDC_ISSUER_URL not set, logins are disabled")
+	}
+
+	// Bearer token setup
+	var jwtSecret []byte
+	if cfg.Auth.JWTSecret != "" {
+		jwtSecret = []byte(cfg.Auth.JWTSecret.Value())
+	}
+
+	// Comment moderation setup
+	bannedWords, err := moderation.LoadFilter(cfg.Moderation.BannedWordsFile)
+	if err != nil {
+		slog.Error("Failed to load banned words", slog.String("error", err.Error()))
+		panic("couldn't load banned words")
+	}
+
+	// Signed URL setup
+	var urlSigner *auth.URLSigner
+	if cfg.Auth.URLSigningSecret != "" {
+		urlSigner = auth.NewURLSigner([]byte(cfg.Auth.URLSigningSecret.Value()))
+	}
 
 	return &Application{
+		Config:       cfg,
+		DB:           db,
 		Storage:      storageClient,
 		RabbitClient: rabbitClient,
 		Processor:    processor,
+		OIDC:         oidcClient,
+		JWTSecret:    jwtSecret,
+		URLSigner:    urlSigner,
+		Stats:        analytics.NewRecorder(db, cfg.Stats.ViewDedupWindow, cfg.Stats.FlushInterval),
+		BannedWords:  bannedWords,
 	}
 }
 
 // Starts a consumer that processes video processing requests from RabbitMQ.
-func (app *Application) StartConsumers() {
-	videoProcessingQueueName := "video_processing"
-	app.RabbitClient.StartConsumer(videoProcessingQueueName, func(message []byte) error {
+func (app *Application) StartConsumers() error {
+	err := app.RabbitClient.StartConsumer(app.Config.Queue.Name, func(ctx context.Context, message []byte) error {
 		slog.Info("Received a message", slog.String("body", string(message)))
-		if err := app.Processor.Process(string(message)); err != nil {
-			slog.Error("Error processing video", slog.String("error", err.Error()))
+		job, err := video.ParseJob(message)
+		if err != nil {
+			return fmt.Errorf("%w: %w", queueing.ErrPermanent, err)
+		}
+		if job.RequestID != "" {
+			ctx = logging.WithRequestID(ctx, job.RequestID)
+		}
+		ctx = logging.With(ctx, slog.String("job_type", job.Type))
+
+		if err := app.Processor.RunJob(ctx, job); err != nil {
+			logging.FromContext(ctx).Error("Error running job", slog.String("video_id", job.VideoID), slog.String("error", err.Error()))
+			// Retrying won't help if the video has gone or the job is one we don't know
+			if errors.Is(err, database.ErrNotFound) || errors.Is(err, video.ErrUnknownJobType) {
+				return fmt.Errorf("%w: %w", queueing.ErrPermanent, err)
+			}
+			return err
 		}
 		return nil
 	})
-	slog.Info("RabbitMQ consumer started", slog.String("queue", videoProcessingQueueName))
+	if err != nil {
+		return err
+	}
+	slog.Info("RabbitMQ consumer started", slog.String("queue", app.Config.Queue.Name))
+
+	app.resumeDeletes(time.Now())
+	return nil
+}
+
+// How often workers look for deletes that haven't finished, and how long a
+// delete is given before it's queued again.
+const stalledDeleteInterval = 10 * time.Minute
+
+// Requeues deletes that have been pending for a while until ctx is done, such
+// as ones whose job couldn't be queued when they were requested.
+func (app *Application) resumeStalledDeletes(ctx context.Context) {
+	ticker := time.NewTicker(stalledDeleteInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.resumeDeletes(time.Now().Add(-stalledDeleteInterval))
+		}
+	}
+}
+
+// Requeues deletes for videos flagged for deletion before the given time, in
+// case their job was never queued or a previous run stopped before finishing it.
+// Deletes can be resumed, so queueing one that's still running is harmless.
+func (app *Application) resumeDeletes(before time.Time) {
+	ids, err := app.DB.ListDeletingVideoIDs(context.Background(), before)
+	if err != nil {
+		slog.Error("Failed to list videos pending deletion", slog.String("error", err.Error()))
+		return
+	}
+
+	for _, id := range ids {
+		if err := app.enqueue(context.Background(), video.Job{Type: video.JobTypeDelete, VideoID: id}); err != nil {
+			slog.Error("Failed to requeue video deletion", slog.String("video_id", id), slog.String("error", err.Error()))
+			continue
+		}
+		slog.Info("Resumed video deletion", slog.String("video_id", id))
+	}
+}
+
+// Publishes a job onto the video processing queue, carrying the trace and
+// request ID in ctx.
+func (app *Application) enqueue(ctx context.Context, job video.Job) error {
+	job.RequestID = logging.RequestID(ctx)
+	body, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return app.RabbitClient.Publish(ctx, app.Config.Queue.Name, body)
 }
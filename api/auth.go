@@ -0,0 +1,185 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dantdj/goreel/auth"
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+)
+
+const (
+	sessionCookieName    = "goreel_session"
+	loginStateCookieName = "goreel_login_state"
+	sessionLifetime      = 14 * 24 * time.Hour
+)
+
+// Starts a login by sending the user to the OIDC provider. An optional
+// "redirect_to" query parameter sets where the user ends up once logged in,
+// and must be a path on this site.
+func (app *Application) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	redirectTo := r.URL.Query().Get("redirect_to")
+	if redirectTo == "" {
+		redirectTo = "/"
+	}
+	if !isLocalPath(redirectTo) {
+		badRequestResponse(w, "redirect_to must be a path on this site")
+		return
+	}
+
+	state, err := auth.RandomToken()
+	if err != nil {
+		logger.Error("Failed to generate login state", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+	nonce, err := auth.RandomToken()
+	if err != nil {
+		logger.Error("Failed to generate login nonce", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	attempt := &database.LoginAttempt{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: auth.NewCodeVerifier(),
+		RedirectTo:   redirectTo,
+	}
+	if err := app.DB.CreateLoginAttempt(r.Context(), attempt); err != nil {
+		logger.Error("Failed to record login attempt", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	// Tie the attempt to this browser, so a callback started elsewhere is rejected
+	http.SetCookie(w, app.cookie(loginStateCookieName, state, 10*time.Minute))
+	http.Redirect(w, r, app.OIDC.AuthCodeURL(state, nonce, attempt.CodeVerifier), http.StatusFound)
+}
+
+// Completes a login when the OIDC provider sends the user back, creating the
+// user on their first login and starting a session.
+func (app *Application) LoginCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		logger.Info("Login rejected by provider", slog.String("error", providerErr))
+		errorResponse(w, http.StatusUnauthorized, "the login was not completed")
+		return
+	}
+
+	state := query.Get("state")
+	stateCookie, err := r.Cookie(loginStateCookieName)
+	if state == "" || err != nil || stateCookie.Value != state {
+		badRequestResponse(w, "invalid login state")
+		return
+	}
+	http.SetCookie(w, app.cookie(loginStateCookieName, "", -1))
+
+	attempt, err := app.DB.ConsumeLoginAttempt(r.Context(), state)
+	if errors.Is(err, database.ErrNotFound) {
+		badRequestResponse(w, "the login has expired, please try again")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to get login attempt", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	identity, err := app.OIDC.Exchange(r.Context(), query.Get("code"), attempt.CodeVerifier, attempt.Nonce)
+	if err != nil {
+		logger.Error("Failed to complete login", slog.String("error", err.Error()))
+		errorResponse(w, http.StatusUnauthorized, "the login could not be verified")
+		return
+	}
+
+	user, err := app.DB.UpsertUserByIdentity(r.Context(), identity.Issuer, identity.Subject, identity.Email, identity.Name)
+	if err != nil {
+		logger.Error("Failed to record user", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	token, err := auth.RandomToken()
+	if err != nil {
+		logger.Error("Failed to generate session token", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+	if err := app.DB.CreateSession(r.Context(), token, user.ID, time.Now().Add(sessionLifetime)); err != nil {
+		logger.Error("Failed to create session", slog.Int64("user_id", user.ID), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	logger.Info("User logged in", slog.Int64("user_id", user.ID))
+
+	http.SetCookie(w, app.cookie(sessionCookieName, token, sessionLifetime))
+	http.Redirect(w, r, attempt.RedirectTo, http.StatusFound)
+}
+
+// Ends the current session.
+func (app *Application) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		if err := app.DB.DeleteSession(r.Context(), cookie.Value); err != nil {
+			logger.Error("Failed to delete session", slog.String("error", err.Error()))
+			serverErrorResponse(w)
+			return
+		}
+	}
+
+	http.SetCookie(w, app.cookie(sessionCookieName, "", -1))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Returns the logged in user.
+func (app *Application) ShowCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	user := contextGetUser(r)
+	if user == nil {
+		authenticationRequiredResponse(w)
+		return
+	}
+
+	if err := writeJSON(w, http.StatusOK, envelope{"user": user}, nil); err != nil {
+		logger.Error("Failed to return user", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Builds a cookie scoped to the whole site. A negative maxAge removes the cookie.
+func (app *Application) cookie(name, value string, maxAge time.Duration) *http.Cookie {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		// Lax still sends the cookie when the provider redirects back to us
+		SameSite: http.SameSiteLaxMode,
+		// Local development runs over plain HTTP
+		Secure: !app.Config.Local,
+	}
+	if maxAge < 0 {
+		c.MaxAge = -1
+	} else {
+		c.MaxAge = int(maxAge.Seconds())
+	}
+	return c
+}
+
+// Reports whether the target is a path on this site, rather than a URL that
+// could send the user somewhere else.
+func isLocalPath(target string) bool {
+	return strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//") && !strings.Contains(target, `\`)
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+	"github.com/dantdj/goreel/video"
+)
+
+// Caption files are small, so anything bigger than this is almost certainly a mistake.
+var maxCaptionFileSize = 5 * 1024 * 1024
+
+// Loose BCP 47 check, e.g. "en", "pt-BR", "zh-Hant".
+var languageTagRX = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+func (app *Application) ListCaptionsHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+
+	if !app.videoViewable(w, r, id) {
+		return
+	}
+
+	captions, err := app.DB.ListCaptions(r.Context(), id)
+	if err != nil {
+		logger.Error("Failed to list captions", slog.String("video_id", id), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	if err := writeJSON(w, http.StatusOK, envelope{"captions": captions}, nil); err != nil {
+		logger.Error("Failed to return captions", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Creates or replaces the caption track for a language. Expects a multipart form
+// with a "caption_file" part holding SRT or WebVTT, and optional "label" and
+// "default" fields.
+func (app *Application) PutCaptionHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+	language := routeParam(r, "language")
+
+	if !languageTagRX.MatchString(language) {
+		badRequestResponse(w, "language must be a BCP 47 language tag")
+		return
+	}
+
+	if _, ok := app.editableVideo(w, r, id); !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxCaptionFileSize))
+	if err := r.ParseMultipartForm(int64(maxCaptionFileSize)); err != nil {
+		badRequestResponse(w, "invalid multipart request")
+		return
+	}
+
+	file, _, err := r.FormFile("caption_file")
+	if err != nil {
+		badRequestResponse(w, "caption_file field not found")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		logger.Error("Error reading caption file", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	caption := &database.Caption{
+		VideoID:  id,
+		Language: language,
+		Label:    r.FormValue("label"),
+	}
+	if caption.Label == "" {
+		caption.Label = language
+	}
+	if value := r.FormValue("default"); value != "" {
+		caption.IsDefault, err = strconv.ParseBool(value)
+		if err != nil {
+			badRequestResponse(w, "default must be a boolean")
+			return
+		}
+	}
+
+	cues, err := video.ParseCaptions(data)
+	if err != nil {
+		errorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if err := app.Processor.PublishCaptions(r.Context(), caption, cues); err != nil {
+		logger.Error("Failed to publish captions", slog.String("video_id", id), slog.String("language", language), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	if err := writeJSON(w, http.StatusOK, envelope{"caption": caption}, nil); err != nil {
+		logger.Error("Failed to return caption", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+func (app *Application) DeleteCaptionHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+	language := routeParam(r, "language")
+
+	if _, ok := app.editableVideo(w, r, id); !ok {
+		return
+	}
+
+	err := app.Processor.RemoveCaptions(r.Context(), id, language)
+	if errors.Is(err, database.ErrNotFound) {
+		notFoundResponse(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to remove captions", slog.String("video_id", id), slog.String("language", language), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+	"github.com/dantdj/goreel/video"
+)
+
+func (app *Application) ListChaptersHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+
+	if !app.videoViewable(w, r, id) {
+		return
+	}
+
+	chapters, err := app.DB.ListChapters(r.Context(), id)
+	if err != nil {
+		logger.Error("Failed to list chapters", slog.String("video_id", id), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	if err := writeJSON(w, http.StatusOK, envelope{"chapters": chapters}, nil); err != nil {
+		logger.Error("Failed to return chapters", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Replaces all of a video's chapters. Expects a JSON body of the form
+// {"chapters": [{"start": 0, "title": "Intro"}, ...]}.
+func (app *Application) ReplaceChaptersHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+
+	var input struct {
+		Chapters []struct {
+			Start float64 `json:"start"`
+			Title string  `json:"title"`
+		} `json:"chapters"`
+	}
+	if err := readJSON(w, r, &input); err != nil {
+		badRequestResponse(w, err.Error())
+		return
+	}
+
+	chapters := make([]database.Chapter, len(input.Chapters))
+	for i, c := range input.Chapters {
+		chapters[i] = database.Chapter{Start: c.Start, Title: strings.TrimSpace(c.Title)}
+	}
+	slices.SortFunc(chapters, func(a, b database.Chapter) int {
+		return cmp.Compare(a.Start, b.Start)
+	})
+	for i, c := range chapters {
+		if message := validateChapter(c); message != "" {
+			badRequestResponse(w, message)
+			return
+		}
+		if i > 0 && c.Start == chapters[i-1].Start {
+			badRequestResponse(w, "chapters must have distinct start times")
+			return
+		}
+	}
+
+	if _, ok := app.editableVideo(w, r, id); !ok {
+		return
+	}
+
+	if err := app.DB.ReplaceChapters(r.Context(), id, chapters); err != nil {
+		logger.Error("Failed to replace chapters", slog.String("video_id", id), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	app.ListChaptersHandler(w, r)
+}
+
+// Updates the start time and/or title of a single chapter.
+func (app *Application) UpdateChapterHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+	chapterId, err := strconv.ParseInt(routeParam(r, "chapter"), 10, 64)
+	if err != nil {
+		notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Start *float64 `json:"start"`
+		Title *string  `json:"title"`
+	}
+	if err := readJSON(w, r, &input); err != nil {
+		badRequestResponse(w, err.Error())
+		return
+	}
+
+	if _, ok := app.editableVideo(w, r, id); !ok {
+		return
+	}
+
+	chapter, err := app.DB.GetChapter(r.Context(), id, chapterId)
+	if errors.Is(err, database.ErrNotFound) {
+		notFoundResponse(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to get chapter", slog.String("video_id", id), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	if input.Start != nil {
+		chapter.Start = *input.Start
+	}
+	if input.Title != nil {
+		chapter.Title = strings.TrimSpace(*input.Title)
+	}
+	if message := validateChapter(*chapter); message != "" {
+		badRequestResponse(w, message)
+		return
+	}
+
+	err = app.DB.UpdateChapter(r.Context(), chapter)
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		notFoundResponse(w, r)
+		return
+	case errors.Is(err, database.ErrConflict):
+		errorResponse(w, http.StatusConflict, "another chapter already starts at that time")
+		return
+	case err != nil:
+		logger.Error("Failed to update chapter", slog.String("video_id", id), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	if err := writeJSON(w, http.StatusOK, envelope{"chapter": chapter}, nil); err != nil {
+		logger.Error("Failed to return chapter", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Returns a message describing what's wrong with the chapter, or an empty string if it's valid.
+func validateChapter(c database.Chapter) string {
+	switch {
+	case c.Start < 0:
+		return "chapter start must not be negative"
+	case c.Title == "":
+		return "chapter title must be provided"
+	case len(c.Title) > 200:
+		return "chapter title must not be more than 200 bytes long"
+	}
+	return ""
+}
+
+// Serves the video's chapters as the WebVTT chapters track, its media playlist
+// or the JSON document referenced from the master playlist, depending on the
+// file asked for.
+func (app *Application) chaptersFile(w http.ResponseWriter, r *http.Request, v *database.Video, file string) {
+	logger := logging.FromContext(r.Context())
+
+	chapters, err := app.DB.ListChapters(r.Context(), v.ID)
+	if err != nil {
+		logger.Error("Failed to list chapters", slog.String("video_id", v.ID), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+	if len(chapters) == 0 || v.Duration == nil {
+		notFoundResponse(w, r)
+		return
+	}
+
+	if file == video.ChaptersPlaylistName {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		io.WriteString(w, app.signPlaylist(r, video.ChaptersPlaylist(*v.Duration)))
+		return
+	}
+
+	write, contentType := video.WriteChaptersWebVTT, "text/vtt"
+	if file == video.ChaptersDataName {
+		write, contentType = video.WriteChaptersJSON, "application/json"
+	}
+
+	var buf bytes.Buffer
+	if err := write(&buf, chapters, *v.Duration); err != nil {
+		logger.Error("Failed to write chapters", slog.String("video_id", v.ID), slog.String("file_name", file), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(buf.Bytes())
+}
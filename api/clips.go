@@ -0,0 +1,78 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+	"github.com/dantdj/goreel/utils"
+	"github.com/dantdj/goreel/video"
+)
+
+// Creates a new video from a section of an existing one. Expects a JSON body with
+// "start" and "end" offsets into the source, in seconds. The clip is cut and
+// processed in the background, so this responds as soon as the job is queued.
+func (app *Application) CreateClipHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	sourceId := routeParam(r, "id")
+
+	var input struct {
+		Start *float64 `json:"start"`
+		End   *float64 `json:"end"`
+	}
+	if err := readJSON(w, r, &input); err != nil {
+		badRequestResponse(w, err.Error())
+		return
+	}
+
+	switch {
+	case input.Start == nil || input.End == nil:
+		badRequestResponse(w, "start and end are required")
+		return
+	case *input.Start < 0:
+		badRequestResponse(w, "start must not be negative")
+		return
+	case *input.End <= *input.Start:
+		badRequestResponse(w, "end must be after start")
+		return
+	}
+
+	// Clips copy the source's media, so only videos the request can see can be clipped
+	source, ok := app.viewableVideo(w, r, sourceId)
+	if !ok {
+		return
+	}
+	if source.Status != database.VideoStatusReady {
+		errorResponse(w, http.StatusConflict, "the source video has not finished processing")
+		return
+	}
+
+	clipId, err := utils.GenerateRandomId()
+	if err != nil {
+		logger.Error("Failed to generate clip ID", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	clip, err := app.DB.CreateClip(r.Context(), clipId, sourceId, *input.Start, *input.End, requestOwnerID(r))
+	if err != nil {
+		logger.Error("Failed to record clip", slog.String("video_id", clipId), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	if err := app.enqueue(r.Context(), video.Job{Type: video.JobTypeClip, VideoID: clipId}); err != nil {
+		logger.Error("Failed to publish message to RabbitMQ", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	logger.Info("Queued clip", slog.String("video_id", clipId), slog.String("source_video_id", sourceId))
+
+	if err := writeJSON(w, http.StatusAccepted, envelope{"video": clip}, nil); err != nil {
+		logger.Error("Failed to return clip", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dantdj/goreel/auth"
+	"github.com/dantdj/goreel/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Opens the database named by GOREEL_TEST_DATABASE_URL, skipping the test if it isn't set.
+func openTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	url := os.Getenv("GOREEL_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("GOREEL_TEST_DATABASE_URL not set")
+	}
+
+	db, err := database.Open(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	if err := db.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestCreateClipHandler_PrivateSource(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	app := &Application{DB: db}
+
+	id := "clip-test-private"
+	ownerId := "1"
+	if err := db.CreateVideo(ctx, id, "default", &ownerId); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.DeleteVideo(context.Background(), id) })
+
+	v := &database.Video{ID: id, Title: "Private", Visibility: database.VisibilityPrivate}
+	if err := db.UpdateVideoMetadata(ctx, v); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetVideoStatus(ctx, id, database.VideoStatusReady); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/videos/"+id+"/clips", strings.NewReader(`{"start": 0, "end": 1}`))
+	r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: id}}))
+	r = contextSetScopes(r, []string{auth.ScopeUpload})
+	r = contextSetUser(r, &database.User{ID: 2})
+
+	w := httptest.NewRecorder()
+	app.CreateClipHandler(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
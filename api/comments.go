@@ -0,0 +1,349 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dantdj/goreel/auth"
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+)
+
+const maxCommentLength = 5000
+
+var commentStatuses = []string{
+	database.CommentStatusVisible,
+	database.CommentStatusHeld,
+	database.CommentStatusRemoved,
+}
+
+// Lists a video's top-level comments, newest first, paging with the cursor and
+// page_size query parameters. Held comments are only shown to their authors
+// and moderators.
+func (app *Application) ListCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	id := routeParam(r, "id")
+
+	if !app.videoViewable(w, r, id) {
+		return
+	}
+
+	filter := app.commentFilter(r, id)
+	filter.NewestFirst = true
+	app.listComments(w, r, filter)
+}
+
+// Lists the replies to a comment, oldest first, paging with the cursor and
+// page_size query parameters.
+func (app *Application) ListRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	id := routeParam(r, "id")
+
+	if !app.videoViewable(w, r, id) {
+		return
+	}
+	parent, ok := app.viewableComment(w, r, id)
+	if !ok {
+		return
+	}
+
+	filter := app.commentFilter(r, id)
+	filter.ParentID = &parent.ID
+	app.listComments(w, r, filter)
+}
+
+// Adds a comment to a video as the logged in user. Expects a JSON body with the
+// comment's "body", and a "parent_id" when replying to another comment.
+// Comments containing banned words are held for review.
+func (app *Application) CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+	user := contextGetUser(r)
+
+	var input struct {
+		Body     string `json:"body"`
+		ParentID *int64 `json:"parent_id"`
+	}
+	if err := readJSON(w, r, &input); err != nil {
+		badRequestResponse(w, err.Error())
+		return
+	}
+
+	body, msg := validateCommentBody(input.Body)
+	if msg != "" {
+		badRequestResponse(w, msg)
+		return
+	}
+
+	if !app.videoViewable(w, r, id) {
+		return
+	}
+
+	comment := &database.Comment{
+		VideoID:  id,
+		ParentID: input.ParentID,
+		UserID:   user.ID,
+		Body:     body,
+		Status:   database.CommentStatusVisible,
+	}
+	if app.BannedWords.Matches(body) {
+		comment.Status = database.CommentStatusHeld
+	}
+
+	err := app.DB.CreateComment(r.Context(), comment)
+	if errors.Is(err, database.ErrNotFound) {
+		badRequestResponse(w, "parent_id must be a comment on this video")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to create comment", slog.String("video_id", id), slog.Int64("user_id", user.ID), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	if comment.Status == database.CommentStatusHeld {
+		logger.Info("Held comment for review", slog.Int64("comment_id", comment.ID), slog.String("video_id", id))
+	}
+
+	if err := writeJSON(w, http.StatusCreated, envelope{"comment": comment}, nil); err != nil {
+		logger.Error("Failed to return comment", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Edits the body of one of the logged in user's comments. An edit that adds a
+// banned word holds the comment for review. Held comments stay held until a
+// moderator releases them.
+func (app *Application) UpdateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+	user := contextGetUser(r)
+
+	var input struct {
+		Body string `json:"body"`
+	}
+	if err := readJSON(w, r, &input); err != nil {
+		badRequestResponse(w, err.Error())
+		return
+	}
+
+	body, msg := validateCommentBody(input.Body)
+	if msg != "" {
+		badRequestResponse(w, msg)
+		return
+	}
+
+	comment, ok := app.viewableComment(w, r, id)
+	if !ok {
+		return
+	}
+	if comment.UserID != user.ID {
+		notPermittedResponse(w)
+		return
+	}
+	if comment.Status == database.CommentStatusRemoved {
+		errorResponse(w, http.StatusConflict, "removed comments can't be edited")
+		return
+	}
+
+	comment.Body = body
+	if app.BannedWords.Matches(body) {
+		comment.Status = database.CommentStatusHeld
+	}
+
+	err := app.DB.UpdateComment(r.Context(), comment)
+	if errors.Is(err, database.ErrNotFound) {
+		errorResponse(w, http.StatusConflict, "removed comments can't be edited")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to update comment", slog.Int64("comment_id", comment.ID), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	if err := writeJSON(w, http.StatusOK, envelope{"comment": comment}, nil); err != nil {
+		logger.Error("Failed to return comment", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Removes a comment. Authors can remove their own comments, and logged in
+// admins any comment. Admin credentials without a user moderate comments
+// through /admin/comments instead. Replies to a removed comment are kept.
+func (app *Application) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+	user := contextGetUser(r)
+
+	comment, ok := app.viewableComment(w, r, id)
+	if !ok {
+		return
+	}
+
+	isAdmin := auth.HasScope(contextGetScopes(r), auth.ScopeAdmin)
+	if !isAdmin && comment.UserID != user.ID {
+		notPermittedResponse(w)
+		return
+	}
+
+	_, err := app.DB.SetCommentStatus(r.Context(), comment.ID, database.CommentStatusRemoved)
+	// Removing a comment that's already removed is fine
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		logger.Error("Failed to remove comment", slog.Int64("comment_id", comment.ID), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Lists comments in a moderation state across all videos, oldest first, for
+// review. The state is set with the status query parameter, defaulting to held.
+func (app *Application) ListModerationCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = database.CommentStatusHeld
+	}
+	if !slices.Contains(commentStatuses, status) {
+		badRequestResponse(w, fmt.Sprintf("status must be one of %v", commentStatuses))
+		return
+	}
+
+	app.listComments(w, r, database.CommentFilter{Status: status, Cursor: r.URL.Query().Get("cursor")})
+}
+
+// Moves a comment to a new moderation state. Expects a JSON body with the new
+// "status". Removed comments lose their body, so can't be restored.
+func (app *Application) ModerateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	commentId, err := strconv.ParseInt(routeParam(r, "comment"), 10, 64)
+	if err != nil || commentId < 1 {
+		notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Status string `json:"status"`
+	}
+	if err := readJSON(w, r, &input); err != nil {
+		badRequestResponse(w, err.Error())
+		return
+	}
+	if !slices.Contains(commentStatuses, input.Status) {
+		badRequestResponse(w, fmt.Sprintf("status must be one of %v", commentStatuses))
+		return
+	}
+
+	comment, err := app.DB.SetCommentStatus(r.Context(), commentId, input.Status)
+	if errors.Is(err, database.ErrNotFound) {
+		notFoundResponse(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to moderate comment", slog.Int64("comment_id", commentId), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	logger.Info("Moderated comment", slog.Int64("comment_id", commentId), slog.String("status", input.Status))
+
+	if err := writeJSON(w, http.StatusOK, envelope{"comment": comment}, nil); err != nil {
+		logger.Error("Failed to return comment", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Builds a filter for a video's comments that shows held comments to their
+// authors and to admins.
+func (app *Application) commentFilter(r *http.Request, videoId string) database.CommentFilter {
+	filter := database.CommentFilter{
+		VideoID:     videoId,
+		IncludeHeld: auth.HasScope(contextGetScopes(r), auth.ScopeAdmin),
+		Cursor:      r.URL.Query().Get("cursor"),
+	}
+	if user := contextGetUser(r); user != nil {
+		filter.ViewerID = &user.ID
+	}
+	return filter
+}
+
+// Writes a page of comments matching the filter.
+func (app *Application) listComments(w http.ResponseWriter, r *http.Request, filter database.CommentFilter) {
+	logger := logging.FromContext(r.Context())
+
+	limit, ok := pageSize(w, r)
+	if !ok {
+		return
+	}
+	filter.Limit = limit
+
+	comments, nextCursor, err := app.DB.ListComments(r.Context(), filter)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		badRequestResponse(w, "cursor is invalid")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to list comments", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	if err := writeJSON(w, http.StatusOK, envelope{"comments": comments, "metadata": pageMetadata(filter.Limit, nextCursor)}, nil); err != nil {
+		logger.Error("Failed to return comments", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Gets the comment named in the route, sending a 404 response if it doesn't
+// exist or is held and the request isn't from its author or an admin.
+func (app *Application) viewableComment(w http.ResponseWriter, r *http.Request, videoId string) (*database.Comment, bool) {
+	logger := logging.FromContext(r.Context())
+
+	commentId, err := strconv.ParseInt(routeParam(r, "comment"), 10, 64)
+	if err != nil || commentId < 1 {
+		notFoundResponse(w, r)
+		return nil, false
+	}
+
+	comment, err := app.DB.GetComment(r.Context(), videoId, commentId)
+	if errors.Is(err, database.ErrNotFound) {
+		notFoundResponse(w, r)
+		return nil, false
+	}
+	if err != nil {
+		logger.Error("Failed to get comment", slog.Int64("comment_id", commentId), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return nil, false
+	}
+
+	if comment.Status == database.CommentStatusHeld && !auth.HasScope(contextGetScopes(r), auth.ScopeAdmin) {
+		user := contextGetUser(r)
+		if user == nil || user.ID != comment.UserID {
+			notFoundResponse(w, r)
+			return nil, false
+		}
+	}
+	return comment, true
+}
+
+// Trims a comment body and checks it's within bounds, returning the trimmed
+// body, or a message describing the problem.
+func validateCommentBody(body string) (string, string) {
+	body = strings.TrimSpace(body)
+	switch {
+	case body == "":
+		return "", "body must be provided"
+	case utf8.RuneCountInString(body) > maxCommentLength:
+		return "", fmt.Sprintf("body must not be more than %d characters long", maxCommentLength)
+	}
+	return body, ""
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/dantdj/goreel/auth"
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+)
+
+type contextKey string
+
+const (
+	userContextKey   = contextKey("user")
+	scopesContextKey = contextKey("scopes")
+	signedContextKey = contextKey("signed_video")
+	accessContextKey = contextKey("access_log")
+)
+
+// Scopes granted to users logged in with a session cookie.
+var sessionScopes = []string{auth.ScopeUpload, auth.ScopeRead}
+
+// Returns a copy of the request with the given user added to its context.
+func contextSetUser(r *http.Request, user *database.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// Returns the user making the request, or nil for anonymous requests.
+func contextGetUser(r *http.Request) *database.User {
+	user, _ := r.Context().Value(userContextKey).(*database.User)
+	return user
+}
+
+// Returns a copy of the request with the given scopes added to its context.
+func contextSetScopes(r *http.Request, scopes []string) *http.Request {
+	ctx := context.WithValue(r.Context(), scopesContextKey, scopes)
+	return r.WithContext(ctx)
+}
+
+// Returns the scopes granted to the request, or nil for anonymous requests.
+func contextGetScopes(r *http.Request) []string {
+	scopes, _ := r.Context().Value(scopesContextKey).([]string)
+	return scopes
+}
+
+// Returns a copy of the request, noting that it carried a valid signed URL for the video.
+func contextSetSignedVideo(r *http.Request, videoId string) *http.Request {
+	ctx := context.WithValue(r.Context(), signedContextKey, videoId)
+	return r.WithContext(ctx)
+}
+
+// Returns the video the request's signed URL grants access to, or "" if it wasn't signed.
+func contextGetSignedVideo(r *http.Request) string {
+	videoId, _ := r.Context().Value(signedContextKey).(string)
+	return videoId
+}
+
+// Details of a request filled in as it's handled, for its access log line.
+type accessLogEntry struct {
+	route   string
+	videoID string
+}
+
+// Returns a copy of the request with the given access log entry added to its context.
+func contextSetAccessLog(r *http.Request, entry *accessLogEntry) *http.Request {
+	ctx := context.WithValue(r.Context(), accessContextKey, entry)
+	return r.WithContext(ctx)
+}
+
+// Returns the request's access log entry, or nil if it isn't being logged.
+func contextGetAccessLog(r *http.Request) *accessLogEntry {
+	entry, _ := r.Context().Value(accessContextKey).(*accessLogEntry)
+	return entry
+}
+
+// Returns a copy of the request whose log lines, including its access log
+// line, are tagged with the given video ID.
+func contextSetLogVideoID(r *http.Request, videoId string) *http.Request {
+	if entry := contextGetAccessLog(r); entry != nil {
+		entry.videoID = videoId
+	}
+	return r.WithContext(logging.With(r.Context(), slog.String("video_id", videoId)))
+}
+
+// Returns the owner ID to record against videos created by the request,
+// or nil for anonymous requests.
+func requestOwnerID(r *http.Request) *string {
+	user := contextGetUser(r)
+	if user == nil {
+		return nil
+	}
+	ownerId := user.OwnerID()
+	return &ownerId
+}
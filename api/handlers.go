@@ -5,15 +5,20 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"path"
+	"strings"
 	"time"
 
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+	"github.com/dantdj/goreel/metrics"
 	"github.com/dantdj/goreel/utils"
+	"github.com/dantdj/goreel/video"
 )
 
-var maxRequestBodySize = 500 * 1024 * 1024
-var videoProcessingQueueName = "video_processing"
-
 func (app *Application) PingHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	env := envelope{
 		"status": "available",
 		"system_info": map[string]string{
@@ -22,63 +27,96 @@ func (app *Application) PingHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := writeJSON(w, http.StatusOK, env, nil); err != nil {
-		slog.Error("Failed to return service info", slog.String("error", err.Error()))
+		logger.Error("Failed to return service info", slog.String("error", err.Error()))
 		serverErrorResponse(w)
 	}
 }
 
 func (app *Application) VideoUploadHandler(w http.ResponseWriter, r *http.Request) {
 	// Limit the overall size of the request body
-	r.Body = http.MaxBytesReader(w, r.Body, int64(maxRequestBodySize))
+	r.Body = http.MaxBytesReader(w, r.Body, app.Config.HTTP.MaxUploadBytes)
+
+	logger := logging.FromContext(r.Context())
 
 	// Stream the file directly without buffering to disk
 	reader, err := r.MultipartReader()
 	if err != nil {
-		slog.Error("Error creating multipart reader", slog.String("error", err.Error()))
+		logger.Error("Error creating multipart reader", slog.String("error", err.Error()))
 		http.Error(w, "Invalid multipart request", http.StatusBadRequest)
 		return
 	}
 
+	// An optional "profile" field selects the encoding profile, and must come
+	// before the video_file part as the upload is streamed
+	profile := video.DefaultProfileName
+
 	for {
 		part, err := reader.NextPart()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			slog.Error("Error reading multipart part", slog.String("error", err.Error()))
+			logger.Error("Error reading multipart part", slog.String("error", err.Error()))
 			http.Error(w, "Error reading request body", http.StatusInternalServerError)
 			return
 		}
 
+		if part.FormName() == "profile" {
+			value, err := io.ReadAll(io.LimitReader(part, 256))
+			if err != nil {
+				logger.Error("Error reading profile field", slog.String("error", err.Error()))
+				http.Error(w, "Error reading request body", http.StatusInternalServerError)
+				return
+			}
+			profile = string(value)
+			if _, ok := app.Processor.Profiles[profile]; !ok {
+				badRequestResponse(w, fmt.Sprintf("unknown encoding profile %q", profile))
+				return
+			}
+			continue
+		}
+
 		if part.FormName() == "video_file" {
-			slog.Info("Starting video upload...")
+			logger.Info("Starting video upload...")
 			blobName, err := utils.GenerateRandomId()
 			if err != nil {
-				slog.Error("Failed to generate blob name", slog.String("error", err.Error()))
+				logger.Error("Failed to generate blob name", slog.String("error", err.Error()))
+				serverErrorResponse(w)
+				return
+			}
+			r = contextSetLogVideoID(r, blobName)
+			logger = logging.FromContext(r.Context())
+
+			counter := &countingReader{r: part}
+			blobLocation := app.Storage.Upload(counter, blobName)
+			metrics.UploadBytes.Add(float64(counter.n))
+			if blobLocation == "" {
 				serverErrorResponse(w)
 				return
 			}
 
-			blobLocation := app.Storage.Upload(part, blobName)
+			logger.Info("Uploaded video")
 
-			slog.Info("Uploaded video", slog.String("video_id", blobName))
+			if err := app.DB.CreateVideo(r.Context(), blobName, profile, requestOwnerID(r)); err != nil {
+				logger.Error("Failed to record video", slog.String("error", err.Error()))
+				serverErrorResponse(w)
+				return
+			}
 
 			env := envelope{
 				"video_id": blobName,
 				"location": blobLocation,
 			}
 
-			body := []byte(blobName)
-
-			err = app.RabbitClient.Publish(videoProcessingQueueName, body)
+			err = app.enqueue(r.Context(), video.Job{Type: video.JobTypeProcess, VideoID: blobName})
 			if err != nil {
-				slog.Error("Failed to publish message to RabbitMQ", slog.String("error", err.Error()))
+				logger.Error("Failed to publish message to RabbitMQ", slog.String("error", err.Error()))
 				serverErrorResponse(w)
 				return
 			}
 
 			if err := writeJSON(w, http.StatusOK, env, nil); err != nil {
-				slog.Error("Failed to return service info", slog.String("error", err.Error()))
+				logger.Error("Failed to return service info", slog.String("error", err.Error()))
 				serverErrorResponse(w)
 			}
 			return
@@ -88,34 +126,209 @@ func (app *Application) VideoUploadHandler(w http.ResponseWriter, r *http.Reques
 	http.Error(w, "video_file field not found", http.StatusBadRequest)
 }
 
+// Counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
 func (app *Application) RetrieveVideoHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	id := r.URL.Query().Get("vId")
 
+	if !app.videoViewable(w, r, id) {
+		return
+	}
+
 	videoData, contentLength, contentType := app.Storage.Retrieve(id)
+	if videoData == nil {
+		notFoundResponse(w, r)
+		return
+	}
 	defer videoData.Close()
 
-	slog.Info("Retrieved file", slog.String("file_name", id))
+	logger.Info("Retrieved file", slog.String("file_name", id))
 
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", contentLength))
 	w.Header().Set("Content-Type", contentType)
 
-	_, err := io.Copy(w, videoData)
-	if err != nil {
+	if _, err := io.Copy(w, videoData); err != nil {
 		// At this point, headers have been sent and we can't send an HTTP error status code.
 		// The client might receive an incomplete file or a connection reset.
 		// Log the error and move on.
-		slog.Error("Error streaming file to client", slog.String("file_name", id), slog.String("error", err.Error()))
+		logger.Error("Error streaming file to client", slog.String("file_name", id), slog.String("error", err.Error()))
 		return
 	}
 
-	slog.Info("Successfully streamed file to client", slog.String("file_name", id))
+	logger.Info("Successfully streamed file to client", slog.String("file_name", id))
 }
 
 func (app *Application) ProcessVideoHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	id := r.URL.Query().Get("vId")
 
-	if err := app.Processor.Process(id); err != nil {
-		slog.Error("Failed to process video", slog.String("video_id", id), slog.String("error", err.Error()))
+	if err := app.Processor.Process(r.Context(), id); err != nil {
+		logger.Error("Failed to process video", slog.String("video_id", id), slog.String("error", err.Error()))
 		serverErrorResponse(w)
 	}
 }
+
+// Serves a processed video's HLS files. The master playlist is built on request
+// from the video's renditions and caption tracks; everything else is streamed
+// straight from storage.
+func (app *Application) HLSHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+	file := strings.TrimPrefix(routeParam(r, "file"), "/")
+
+	v, ok := app.viewableVideo(w, r, id)
+	if !ok {
+		return
+	}
+	if v.Status != database.VideoStatusReady {
+		notFoundResponse(w, r)
+		return
+	}
+
+	if file == "master.m3u8" {
+		playlist, err := app.Processor.MasterPlaylist(r.Context(), id)
+		if err != nil {
+			logger.Error("Failed to build master playlist", slog.String("video_id", id), slog.String("error", err.Error()))
+			serverErrorResponse(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		io.WriteString(w, app.signPlaylist(r, playlist.String()))
+		return
+	}
+
+	if file == video.ChaptersTrackName || file == video.ChaptersPlaylistName || file == video.ChaptersDataName {
+		app.chaptersFile(w, r, v, file)
+		return
+	}
+
+	if file == "" || strings.Contains(file, "..") {
+		notFoundResponse(w, r)
+		return
+	}
+
+	data, contentLength, contentType := app.Storage.Retrieve(video.BlobName(id, file))
+	if data == nil {
+		notFoundResponse(w, r)
+		return
+	}
+	defer data.Close()
+
+	// Playlists fetched with a signed URL pass the signature on to the files they list
+	if path.Ext(file) == ".m3u8" && contextGetSignedVideo(r) == id {
+		playlist, err := io.ReadAll(data)
+		if err != nil {
+			logger.Error("Error reading playlist", slog.String("video_id", id), slog.String("file_name", file), slog.String("error", err.Error()))
+			serverErrorResponse(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", hlsContentType(file, contentType))
+		io.WriteString(w, app.signPlaylist(r, string(playlist)))
+		return
+	}
+
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", contentLength))
+	w.Header().Set("Content-Type", hlsContentType(file, contentType))
+
+	if _, err := io.Copy(w, data); err != nil {
+		logger.Error("Error streaming HLS file to client", slog.String("video_id", id), slog.String("file_name", file), slog.String("error", err.Error()))
+	}
+}
+
+// Streams the standalone audio file for a video as a download, for listen mode
+// and podcast-style use.
+func (app *Application) AudioDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+
+	v, ok := app.viewableVideo(w, r, id)
+	if !ok {
+		return
+	}
+	if v.AudioDownload == nil {
+		notFoundResponse(w, r)
+		return
+	}
+
+	data, contentLength, _ := app.Storage.Retrieve(video.BlobName(id, *v.AudioDownload))
+	if data == nil {
+		notFoundResponse(w, r)
+		return
+	}
+	defer data.Close()
+
+	contentType := "audio/mp4"
+	if path.Ext(*v.AudioDownload) == ".mp3" {
+		contentType = "audio/mpeg"
+	}
+
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", contentLength))
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+path.Ext(*v.AudioDownload)))
+
+	if _, err := io.Copy(w, data); err != nil {
+		logger.Error("Error streaming audio to client", slog.String("video_id", id), slog.String("error", err.Error()))
+	}
+}
+
+// Serves the animated preview shown when hovering over a video in a listing.
+func (app *Application) PreviewHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+
+	v, ok := app.viewableVideo(w, r, id)
+	if !ok {
+		return
+	}
+	if v.Preview == nil {
+		notFoundResponse(w, r)
+		return
+	}
+
+	data, contentLength, _ := app.Storage.Retrieve(video.BlobName(id, *v.Preview))
+	if data == nil {
+		notFoundResponse(w, r)
+		return
+	}
+	defer data.Close()
+
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", contentLength))
+	w.Header().Set("Content-Type", "image/"+strings.TrimPrefix(path.Ext(*v.Preview), "."))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+
+	if _, err := io.Copy(w, data); err != nil {
+		logger.Error("Error streaming preview to client", slog.String("video_id", id), slog.String("error", err.Error()))
+	}
+}
+
+// Blobs are uploaded without a content type, so work it out from the extension
+// for the file types players are fussy about.
+func hlsContentType(file, fallback string) string {
+	switch path.Ext(file) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".ts":
+		return "video/mp2t"
+	case ".vtt":
+		return "text/vtt"
+	}
+	return fallback
+}
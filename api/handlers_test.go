@@ -0,0 +1,39 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dantdj/goreel/database"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestPlaybackHandlers_DatabaseError(t *testing.T) {
+	// Nothing listens on port 1, so every query fails
+	pool, err := pgxpool.New(context.Background(), "postgres://goreel@127.0.0.1:1/goreel?connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	app := &Application{DB: database.New(pool)}
+
+	handlers := map[string]http.HandlerFunc{
+		"hls":     app.HLSHandler,
+		"audio":   app.AudioDownloadHandler,
+		"preview": app.PreviewHandler,
+	}
+	for name, handler := range handlers {
+		r := httptest.NewRequest(http.MethodGet, "/videos/abc", nil)
+		params := httprouter.Params{{Key: "id", Value: "abc"}, {Key: "file", Value: "/master.m3u8"}}
+		r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, params))
+
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("%s: expected %d, got %d", name, http.StatusInternalServerError, w.Code)
+		}
+	}
+}
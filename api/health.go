@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/dantdj/goreel/auth"
+	"github.com/dantdj/goreel/health"
+	"github.com/dantdj/goreel/logging"
+	"github.com/dantdj/goreel/video"
+)
+
+// How long each readiness check gets before it counts as failed.
+const readinessTimeout = 2 * time.Second
+
+// Below this much free space in the temp directory, videos can't be processed
+// reliably, so the service reports itself as not ready.
+const minTempFreeBytes = 1024 * 1024 * 1024
+
+// /readyz is unauthenticated, so the FFmpeg and FFprobe versions are cached
+// rather than having every probe start both tools.
+const toolCheckTTL = time.Minute
+
+var (
+	ffmpegCheck = health.Cached(health.Check{Name: "ffmpeg", Run: func(ctx context.Context) (string, error) {
+		return video.ToolVersion(ctx, "ffmpeg")
+	}}, toolCheckTTL)
+	ffprobeCheck = health.Cached(health.Check{Name: "ffprobe", Run: func(ctx context.Context) (string, error) {
+		return video.ToolVersion(ctx, "ffprobe")
+	}}, toolCheckTTL)
+)
+
+// Liveness check. Only says whether the process is up and serving requests, so
+// a dependency outage doesn't get the service restarted.
+func (app *Application) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	if err := writeJSON(w, http.StatusOK, envelope{"status": health.StatusOK}, nil); err != nil {
+		logger.Error("Failed to return liveness status", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Readiness check. Probes every dependency, responding with 503 if any of them
+// are unusable, along with each one's status and latency. Error messages can
+// give away internal addresses, so are only included for admins.
+func (app *Application) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	report := health.Run(r.Context(), app.readinessChecks(), readinessTimeout)
+
+	if !auth.HasScope(contextGetScopes(r), auth.ScopeAdmin) {
+		for name, result := range report.Checks {
+			result.Error = ""
+			report.Checks[name] = result
+		}
+	}
+
+	status := http.StatusOK
+	if report.Status != health.StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	if err := writeJSON(w, status, envelope{"status": report.Status, "checks": report.Checks}, nil); err != nil {
+		logger.Error("Failed to return readiness status", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+func (app *Application) readinessChecks() []health.Check {
+	checks := []health.Check{
+		{Name: "database", Run: func(ctx context.Context) (string, error) {
+			return "", app.DB.Ping(ctx)
+		}},
+		{Name: "rabbitmq", Run: func(ctx context.Context) (string, error) {
+			return "", app.RabbitClient.Ping()
+		}},
+		{Name: "storage", Run: func(ctx context.Context) (string, error) {
+			return "", app.Storage.Ping(ctx)
+		}},
+	}
+
+	// API-only replicas never run FFmpeg, so don't need it installed
+	if app.Mode == ModeServe {
+		return checks
+	}
+
+	return append(checks, []health.Check{
+		ffmpegCheck,
+		ffprobeCheck,
+		{Name: "temp_dir", Run: func(ctx context.Context) (string, error) {
+			free, err := health.FreeSpace(app.Config.Video.TempDir)
+			if err != nil {
+				return "", err
+			}
+			detail := fmt.Sprintf("%d MiB free", free/(1024*1024))
+			if free < minTempFreeBytes {
+				return detail, fmt.Errorf("only %s in %s", detail, app.Config.Video.TempDir)
+			}
+			return detail, nil
+		}},
+	}...)
+}
@@ -2,9 +2,14 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
 )
 
 // A wrapper for an object to be returned as JSON in a response
@@ -38,6 +43,48 @@ func writeJSON(w http.ResponseWriter, status int, data envelope, headers http.He
 	return nil
 }
 
+// Decodes a JSON request body into dst, returning an error with a message that's
+// safe to send back to the client if the body is malformed.
+func readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	// Limit the size of the request body to 1MB
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+			}
+			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		default:
+			// Unknown fields come back as a plain error from the decoder
+			return errors.New(err.Error())
+		}
+	}
+
+	// Make sure there's only a single JSON value in the body
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
 func errorResponse(w http.ResponseWriter, status int, message any) {
 	env := envelope{"error": message}
 
@@ -70,3 +117,61 @@ func methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
 	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
 	errorResponse(w, http.StatusMethodNotAllowed, message)
 }
+
+// Sends a 400 Bad Request status code and JSON response containing the given message.
+func badRequestResponse(w http.ResponseWriter, message string) {
+	errorResponse(w, http.StatusBadRequest, message)
+}
+
+// Sends a 401 Unauthorized status code and JSON response to the client.
+func authenticationRequiredResponse(w http.ResponseWriter) {
+	message := "you must be authenticated to access this resource"
+	errorResponse(w, http.StatusUnauthorized, message)
+}
+
+// Sends a 401 Unauthorized status code and JSON response to the client, with a
+// challenge telling it the bearer token it sent was rejected.
+func invalidAuthenticationTokenResponse(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	message := "invalid or missing authentication token"
+	errorResponse(w, http.StatusUnauthorized, message)
+}
+
+// Sends a 403 Forbidden status code and JSON response to the client.
+func notPermittedResponse(w http.ResponseWriter) {
+	message := "your credentials don't have the necessary permissions to access this resource"
+	errorResponse(w, http.StatusForbidden, message)
+}
+
+// Returns the value of the named route parameter for the current request.
+func routeParam(r *http.Request, name string) string {
+	return httprouter.ParamsFromContext(r.Context()).ByName(name)
+}
+
+// Reads the page_size query parameter, defaulting to defaultPageSize. Sends a
+// 400 response and returns false if it's out of range.
+func pageSize(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := r.URL.Query().Get("page_size")
+	if value == "" {
+		return defaultPageSize, true
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > maxPageSize {
+		badRequestResponse(w, fmt.Sprintf("page_size must be between 1 and %d", maxPageSize))
+		return 0, false
+	}
+	return n, true
+}
+
+// Builds the metadata returned alongside a page of results.
+func pageMetadata(limit int, nextCursor string) map[string]any {
+	metadata := map[string]any{
+		"page_size": limit,
+		"has_more":  nextCursor != "",
+	}
+	if nextCursor != "" {
+		metadata["next_cursor"] = nextCursor
+	}
+	return metadata
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/dantdj/goreel/logging"
+)
+
+// Shows the current default log level and any per-package overrides.
+func (app *Application) ShowLogLevelsHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeLogLevels(w, r)
+}
+
+// Changes log levels without a restart. Expects a JSON body with an optional
+// "default" level, and a "packages" object mapping package names, such as
+// "video" or "api", to levels. A null level removes a package's override.
+func (app *Application) UpdateLogLevelsHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	var input struct {
+		Default  *string            `json:"default"`
+		Packages map[string]*string `json:"packages"`
+	}
+	if err := readJSON(w, r, &input); err != nil {
+		badRequestResponse(w, err.Error())
+		return
+	}
+
+	// Check everything before changing anything, so a bad level doesn't leave
+	// the update half applied
+	var fallback *slog.Level
+	if input.Default != nil {
+		level, err := logging.ParseLevel(*input.Default)
+		if err != nil {
+			badRequestResponse(w, "default must be debug, info, warn or error")
+			return
+		}
+		fallback = &level
+	}
+	overrides := map[string]*slog.Level{}
+	for pkg, name := range input.Packages {
+		if strings.TrimSpace(pkg) == "" {
+			badRequestResponse(w, "package names must not be empty")
+			return
+		}
+		if name == nil {
+			overrides[pkg] = nil
+			continue
+		}
+		level, err := logging.ParseLevel(*name)
+		if err != nil {
+			badRequestResponse(w, "level for package "+pkg+" must be debug, info, warn or error")
+			return
+		}
+		overrides[pkg] = &level
+	}
+
+	if fallback != nil {
+		app.LogLevels.SetDefault(*fallback)
+	}
+	for pkg, level := range overrides {
+		if level == nil {
+			app.LogLevels.Unset(pkg)
+		} else {
+			app.LogLevels.Set(pkg, *level)
+		}
+	}
+
+	logger.Info("Updated log levels", slog.String("default", app.LogLevels.Default().String()), slog.Any("packages", app.LogLevels.Packages()))
+
+	app.writeLogLevels(w, r)
+}
+
+func (app *Application) writeLogLevels(w http.ResponseWriter, r *http.Request) {
+	packages := map[string]string{}
+	for pkg, level := range app.LogLevels.Packages() {
+		packages[pkg] = level.String()
+	}
+
+	env := envelope{
+		"default":  app.LogLevels.Default().String(),
+		"packages": packages,
+	}
+	if err := writeJSON(w, http.StatusOK, env, nil); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to return log levels", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
@@ -1,13 +1,31 @@
 package api
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
 	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dantdj/goreel/auth"
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+	"github.com/dantdj/goreel/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Returned when a bearer token doesn't match an active API key or valid JWT.
+var errInvalidCredentials = errors.New("invalid credentials")
+
 func recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
+				logging.FromContext(r.Context()).Error("Recovered from panic", slog.Any("panic", err))
 				w.Header().Set("Connection", "close")
 				serverErrorResponse(w)
 			}
@@ -16,3 +34,226 @@ func recoverPanic(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// Identifies who is making the request, from a bearer API key or JWT in the
+// Authorization header, or failing that a session cookie. Requests without
+// any credentials carry on anonymously, but invalid bearer tokens are rejected
+// outright rather than being silently downgraded.
+func (app *Application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		if header := r.Header.Get("Authorization"); header != "" {
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok || token == "" {
+				invalidAuthenticationTokenResponse(w)
+				return
+			}
+
+			scopes, err := app.bearerScopes(r, token)
+			if errors.Is(err, errInvalidCredentials) {
+				invalidAuthenticationTokenResponse(w)
+				return
+			}
+			if err != nil {
+				logging.FromContext(r.Context()).Error("Failed to check bearer token", slog.String("error", err.Error()))
+				serverErrorResponse(w)
+				return
+			}
+
+			next.ServeHTTP(w, contextSetScopes(r, scopes))
+			return
+		}
+
+		cookie, err := r.Cookie(sessionCookieName)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := app.DB.GetUserForSession(r.Context(), cookie.Value)
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			// Clear out the stale cookie so it isn't sent again
+			http.SetCookie(w, app.cookie(sessionCookieName, "", -1))
+		case err != nil:
+			logging.FromContext(r.Context()).Error("Failed to get session", slog.String("error", err.Error()))
+			serverErrorResponse(w)
+			return
+		default:
+			r = contextSetScopes(contextSetUser(r, user), sessionScopes)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Returns the scopes granted by a bearer token, which is either an API key
+// or a JWT signed with the configured secret.
+func (app *Application) bearerScopes(r *http.Request, token string) ([]string, error) {
+	if strings.HasPrefix(token, auth.APIKeyPrefix) {
+		key, err := app.DB.GetAPIKeyByHash(r.Context(), auth.HashAPIKey(token))
+		if errors.Is(err, database.ErrNotFound) {
+			return nil, errInvalidCredentials
+		}
+		if err != nil {
+			return nil, err
+		}
+		return key.Scopes, nil
+	}
+
+	if app.JWTSecret == nil {
+		return nil, errInvalidCredentials
+	}
+	claims, err := auth.ParseJWT(app.JWTSecret, token)
+	if err != nil {
+		logging.FromContext(r.Context()).Info("Rejected bearer token", slog.String("error", err.Error()))
+		return nil, errInvalidCredentials
+	}
+	return claims.Scopes, nil
+}
+
+// Wraps a handler so it's only run for requests granted the given scope.
+// Anonymous requests get a 401, and authenticated ones without the scope a 403.
+func (app *Application) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scopes := contextGetScopes(r)
+		if scopes == nil {
+			authenticationRequiredResponse(w)
+			return
+		}
+		if !auth.HasScope(scopes, scope) {
+			notPermittedResponse(w)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// Wraps a handler so it's only run for logged in users. Requests authenticated
+// with an API key or JWT aren't tied to a user, so are refused too.
+func (app *Application) requireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if contextGetUser(r) == nil {
+			errorResponse(w, http.StatusUnauthorized, "you must be logged in to access this resource")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// Records the status code a handler responds with, and the size of the body.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += int64(n)
+	return n, err
+}
+
+// Lets http.ResponseController reach the underlying writer, for flushing.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// Counts and times requests to a route, and names the request's span and access
+// log after it. The route pattern is used rather than the path, so video IDs
+// don't create a new series each. Requests for a video have their log lines
+// tagged with its ID.
+func (app *Application) instrument(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(attribute.String("http.route", route))
+
+		if entry := contextGetAccessLog(r); entry != nil {
+			entry.route = route
+		}
+		if id := routeParam(r, "id"); id != "" && strings.HasPrefix(route, "/videos/") {
+			r = contextSetLogVideoID(r, id)
+		}
+		sr := &statusRecorder{ResponseWriter: w}
+
+		defer func() {
+			status := sr.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			metrics.HTTPRequests.WithLabelValues(route, r.Method, metrics.Code(status)).Inc()
+			metrics.HTTPRequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		}()
+
+		next.ServeHTTP(sr, r)
+	})
+}
+
+// Only request IDs made of these characters are accepted from clients, so they
+// can't be used to inject anything into logs or response headers.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// Tags each request with an ID, reusing the X-Request-ID header if the client or
+// a proxy in front of us sent one, and echoes it back in the response. The ID is
+// added to the request's logger, carried into any jobs it queues, and written in
+// the access log line logged once the request is finished.
+func (app *Application) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		entry := &accessLogEntry{}
+		r = contextSetAccessLog(r.WithContext(logging.WithRequestID(r.Context(), id)), entry)
+		sr := &statusRecorder{ResponseWriter: w}
+
+		defer func() {
+			status := sr.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			attrs := []any{
+				slog.String("method", r.Method),
+				slog.String("route", entry.route),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Int64("bytes", sr.bytes),
+				slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.String("client_ip", clientIP(r)),
+			}
+			if entry.videoID != "" {
+				attrs = append(attrs, slog.String("video_id", entry.videoID))
+			}
+			logging.FromContext(r.Context()).Info("Handled request", attrs...)
+		}()
+
+		next.ServeHTTP(sr, r)
+	})
+}
+
+// Returns a new random request ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	// crypto/rand.Read never returns an error
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dantdj/goreel/logging"
+)
+
+func TestLogRequests_RequestID(t *testing.T) {
+	app := &Application{}
+	var seen string
+	handler := app.logRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestID(r.Context())
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		reused bool
+	}{
+		{"propagated", "abc-123", true},
+		{"missing", "", false},
+		{"unsafe", "bad id\nforged: line", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/ping", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Request-ID", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			got := w.Header().Get("X-Request-ID")
+			if got != seen {
+				t.Errorf("response ID %q doesn't match the context's %q", got, seen)
+			}
+			if tt.reused && got != tt.header {
+				t.Errorf("expected %q to be reused, got %q", tt.header, got)
+			}
+			if !tt.reused && (got == tt.header || !requestIDPattern.MatchString(got)) {
+				t.Errorf("expected a new request ID, got %q", got)
+			}
+		})
+	}
+}
+
+func TestLogRequests_AccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer slog.SetDefault(previous)
+
+	app := &Application{}
+	handler := app.logRequests(app.instrument("/videos/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})))
+
+	r := httptest.NewRequest(http.MethodPost, "/videos/abc", nil)
+	r.Header.Set("X-Request-ID", "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("couldn't decode access log %q: %v", buf.String(), err)
+	}
+	expected := map[string]any{
+		"msg":        "Handled request",
+		"request_id": "req-1",
+		"method":     "POST",
+		"route":      "/videos/:id",
+		"status":     float64(http.StatusCreated),
+		"bytes":      float64(5),
+	}
+	for key, value := range expected {
+		if line[key] != value {
+			t.Errorf("expected %s to be %v, got %v", key, value, line[key])
+		}
+	}
+}
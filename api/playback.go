@@ -0,0 +1,197 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/dantdj/goreel/auth"
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+	"github.com/dantdj/goreel/video"
+)
+
+const (
+	defaultSignedURLLifetime = time.Hour
+	maxSignedURLLifetime     = 7 * 24 * time.Hour
+)
+
+// Wraps a playback handler so it can be reached either with a signed URL for
+// the video, or with credentials granting the read scope. Requests carrying a
+// signature that doesn't check out are refused, rather than falling back to
+// other credentials.
+func (app *Application) signedOrRead(next http.HandlerFunc) http.HandlerFunc {
+	requireRead := app.requireScope(auth.ScopeRead, next)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if app.URLSigner == nil || !auth.IsSigned(query) {
+			requireRead(w, r)
+			return
+		}
+
+		// The download route takes its video ID from the query
+		id := routeParam(r, "id")
+		if id == "" {
+			id = query.Get("vId")
+		}
+
+		err := app.URLSigner.Verify(id, query, clientIP(r), time.Now())
+		if errors.Is(err, auth.ErrSignatureExpired) {
+			errorResponse(w, http.StatusForbidden, "this link has expired")
+			return
+		}
+		if err != nil {
+			errorResponse(w, http.StatusForbidden, "this link is not valid")
+			return
+		}
+
+		next.ServeHTTP(w, contextSetSignedVideo(r, id))
+	}
+}
+
+// Reports whether the request is allowed to see the video. Private videos can
+// only be seen by their owner, admins and holders of a signed URL for them.
+func (app *Application) canView(r *http.Request, v *database.Video) bool {
+	if v.Visibility != database.VisibilityPrivate {
+		return true
+	}
+	return contextGetSignedVideo(r) == v.ID || app.canEdit(r, v)
+}
+
+// Reports whether the request is allowed to change the video. Only its owner
+// and admins can, whatever the video's visibility.
+func (app *Application) canEdit(r *http.Request, v *database.Video) bool {
+	if auth.HasScope(contextGetScopes(r), auth.ScopeAdmin) {
+		return true
+	}
+	ownerId := requestOwnerID(r)
+	return ownerId != nil && v.OwnerID != nil && *ownerId == *v.OwnerID
+}
+
+// Checks that the video exists and the request can see it, sending a 404 or
+// 500 response if not.
+func (app *Application) videoViewable(w http.ResponseWriter, r *http.Request, id string) bool {
+	_, ok := app.viewableVideo(w, r, id)
+	return ok
+}
+
+// Gets a video the request can see, sending a 404 or 500 response if it can't.
+func (app *Application) viewableVideo(w http.ResponseWriter, r *http.Request, id string) (*database.Video, bool) {
+	logger := logging.FromContext(r.Context())
+
+	v, err := app.DB.GetVideo(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && !app.canView(r, v)) {
+		notFoundResponse(w, r)
+		return nil, false
+	}
+	if err != nil {
+		logger.Error("Failed to get video", slog.String("video_id", id), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return nil, false
+	}
+	return v, true
+}
+
+// Gets a video the request is allowed to change. Writes a 404 if the video
+// doesn't exist or can't be seen, or a 403 if it can be seen but not changed,
+// and returns false.
+func (app *Application) editableVideo(w http.ResponseWriter, r *http.Request, id string) (*database.Video, bool) {
+	v, ok := app.viewableVideo(w, r, id)
+	if !ok {
+		return nil, false
+	}
+	if !app.canEdit(r, v) {
+		notPermittedResponse(w)
+		return nil, false
+	}
+	return v, true
+}
+
+// Passes the signature a playlist was requested with on to every file it lists.
+// Playlists requested without a signature are returned unchanged.
+func (app *Application) signPlaylist(r *http.Request, playlist string) string {
+	if contextGetSignedVideo(r) == "" {
+		return playlist
+	}
+	return video.AppendPlaylistQuery(playlist, auth.SignedParams(r.URL.Query()).Encode())
+}
+
+// Issues signed URLs that give temporary access to a video's playback and
+// downloads, without needing any other credentials. Expects an optional JSON
+// body with "expires_in", in seconds, and a "client_ip" to restrict the URLs to.
+func (app *Application) ShareVideoHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+
+	var input struct {
+		ExpiresIn *int   `json:"expires_in"`
+		ClientIP  string `json:"client_ip"`
+	}
+	if r.ContentLength != 0 {
+		if err := readJSON(w, r, &input); err != nil {
+			badRequestResponse(w, err.Error())
+			return
+		}
+	}
+
+	lifetime := defaultSignedURLLifetime
+	if input.ExpiresIn != nil {
+		lifetime = time.Duration(*input.ExpiresIn) * time.Second
+	}
+	if lifetime <= 0 || lifetime > maxSignedURLLifetime {
+		badRequestResponse(w, "expires_in must be between 1 second and 7 days")
+		return
+	}
+
+	if input.ClientIP != "" {
+		ip := net.ParseIP(input.ClientIP)
+		if ip == nil {
+			badRequestResponse(w, "client_ip must be an IP address")
+			return
+		}
+		input.ClientIP = ip.String()
+	}
+
+	v, ok := app.viewableVideo(w, r, id)
+	if !ok {
+		return
+	}
+
+	expiresAt := time.Now().Add(lifetime).Truncate(time.Second)
+	query := app.URLSigner.Sign(id, expiresAt, input.ClientIP)
+
+	downloadQuery := url.Values{"vId": {id}}
+	for name, values := range query {
+		downloadQuery[name] = values
+	}
+
+	env := envelope{
+		"hls_url":      "/videos/" + url.PathEscape(id) + "/hls/master.m3u8?" + query.Encode(),
+		"download_url": "/download?" + downloadQuery.Encode(),
+		"expires_at":   expiresAt,
+	}
+	if v.AudioDownload != nil {
+		env["audio_url"] = "/videos/" + url.PathEscape(id) + "/audio?" + query.Encode()
+	}
+
+	logger.Info("Issued signed URLs", slog.String("video_id", id), slog.Time("expires_at", expiresAt))
+
+	if err := writeJSON(w, http.StatusCreated, env, nil); err != nil {
+		logger.Error("Failed to return signed URLs", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Returns the IP address the request came from.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dantdj/goreel/auth"
+	"github.com/dantdj/goreel/database"
+)
+
+func TestCanEdit(t *testing.T) {
+	app := &Application{}
+	ownerId := "1"
+	v := &database.Video{ID: "abc", Visibility: database.VisibilityPublic, OwnerID: &ownerId}
+
+	request := func(userId int64, scopes ...string) *http.Request {
+		r := httptest.NewRequest(http.MethodPatch, "/videos/abc", nil)
+		r = contextSetScopes(r, scopes)
+		if userId != 0 {
+			r = contextSetUser(r, &database.User{ID: userId})
+		}
+		return r
+	}
+
+	tests := map[string]struct {
+		r        *http.Request
+		expected bool
+	}{
+		"owner":     {request(1, auth.ScopeUpload), true},
+		"other":     {request(2, auth.ScopeUpload), false},
+		"anonymous": {request(0, auth.ScopeUpload), false},
+		"admin":     {request(0, auth.ScopeAdmin), true},
+		"signed":    {contextSetSignedVideo(request(0), v.ID), false},
+	}
+	for name, tt := range tests {
+		if got := app.canEdit(tt.r, v); got != tt.expected {
+			t.Errorf("%s: expected %t, got %t", name, tt.expected, got)
+		}
+	}
+}
+
+func TestViewerKey(t *testing.T) {
+	request := func(addr string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/videos/abc/beacon", nil)
+		r.RemoteAddr = addr
+		return r
+	}
+
+	if viewerKey(request("192.0.2.1:1234"), "a") == viewerKey(request("192.0.2.1:1234"), "b") {
+		t.Error("expected sessions from the same address to be different viewers")
+	}
+	if viewerKey(request("192.0.2.1:1234"), "a") == viewerKey(request("192.0.2.2:1234"), "a") {
+		t.Error("expected the same session from different addresses to be different viewers")
+	}
+	if viewerKey(request("192.0.2.1:1234"), "a") != viewerKey(request("192.0.2.1:5678"), "a") {
+		t.Error("expected the same session from the same address to be the same viewer")
+	}
+}
@@ -0,0 +1,393 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dantdj/goreel/auth"
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+)
+
+var playlistVisibilities = []string{database.VisibilityPublic, database.VisibilityPrivate}
+
+// Creates an empty playlist for the logged in user. Expects a JSON body with a
+// "title", and optionally a "description" and "visibility", which defaults to
+// private.
+func (app *Application) CreatePlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	user := contextGetUser(r)
+
+	var input struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Visibility  string `json:"visibility"`
+	}
+	if err := readJSON(w, r, &input); err != nil {
+		badRequestResponse(w, err.Error())
+		return
+	}
+
+	p := &database.Playlist{
+		UserID:      user.ID,
+		Title:       strings.TrimSpace(input.Title),
+		Description: strings.TrimSpace(input.Description),
+		Visibility:  input.Visibility,
+	}
+	if p.Visibility == "" {
+		p.Visibility = database.VisibilityPrivate
+	}
+	if msg := validatePlaylist(p); msg != "" {
+		badRequestResponse(w, msg)
+		return
+	}
+
+	if err := app.DB.CreatePlaylist(r.Context(), p); err != nil {
+		logger.Error("Failed to create playlist", slog.Int64("user_id", user.ID), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	if err := writeJSON(w, http.StatusCreated, envelope{"playlist": p}, nil); err != nil {
+		logger.Error("Failed to return playlist", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Lists the logged in user's playlists, newest first, paging with the cursor
+// and page_size query parameters.
+func (app *Application) ListMyPlaylistsHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	user := contextGetUser(r)
+
+	limit, ok := pageSize(w, r)
+	if !ok {
+		return
+	}
+
+	playlists, nextCursor, err := app.DB.ListPlaylists(r.Context(), user.ID, false, r.URL.Query().Get("cursor"), limit)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		badRequestResponse(w, "cursor is invalid")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to list playlists", slog.Int64("user_id", user.ID), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	if err := writeJSON(w, http.StatusOK, envelope{"playlists": playlists, "metadata": pageMetadata(limit, nextCursor)}, nil); err != nil {
+		logger.Error("Failed to return playlists", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Returns a playlist's details. Private playlists are only shown to their owner
+// and admins.
+func (app *Application) ShowPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	p, ok := app.viewablePlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	if err := writeJSON(w, http.StatusOK, envelope{"playlist": p}, nil); err != nil {
+		logger.Error("Failed to return playlist", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Lists a playlist's videos in play order, paging with the cursor and page_size
+// query parameters. Each item links to the nearest playable videos either side
+// of it, so players can move through the playlist continuously, skipping
+// videos that are still processing, failed or private.
+func (app *Application) ListPlaylistItemsHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	p, ok := app.viewablePlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	limit, ok := pageSize(w, r)
+	if !ok {
+		return
+	}
+
+	items, nextCursor, err := app.DB.ListPlaylistItems(r.Context(), database.PlaylistItemFilter{
+		PlaylistID:     p.ID,
+		ViewerOwnerID:  requestOwnerID(r),
+		IncludePrivate: auth.HasScope(contextGetScopes(r), auth.ScopeAdmin),
+		Cursor:         r.URL.Query().Get("cursor"),
+		Limit:          limit,
+	})
+	if errors.Is(err, database.ErrInvalidCursor) {
+		badRequestResponse(w, "cursor is invalid")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to list playlist items", slog.Int64("playlist_id", p.ID), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	if err := writeJSON(w, http.StatusOK, envelope{"items": items, "metadata": pageMetadata(limit, nextCursor)}, nil); err != nil {
+		logger.Error("Failed to return playlist items", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Updates a playlist's title, description or visibility. Only fields included
+// in the JSON body are changed.
+func (app *Application) UpdatePlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	p, ok := app.ownedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		Visibility  *string `json:"visibility"`
+	}
+	if err := readJSON(w, r, &input); err != nil {
+		badRequestResponse(w, err.Error())
+		return
+	}
+
+	if input.Title != nil {
+		p.Title = strings.TrimSpace(*input.Title)
+	}
+	if input.Description != nil {
+		p.Description = strings.TrimSpace(*input.Description)
+	}
+	if input.Visibility != nil {
+		p.Visibility = *input.Visibility
+	}
+	if msg := validatePlaylist(p); msg != "" {
+		badRequestResponse(w, msg)
+		return
+	}
+
+	err := app.DB.UpdatePlaylist(r.Context(), p)
+	if errors.Is(err, database.ErrNotFound) {
+		notFoundResponse(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to update playlist", slog.Int64("playlist_id", p.ID), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	if err := writeJSON(w, http.StatusOK, envelope{"playlist": p}, nil); err != nil {
+		logger.Error("Failed to return playlist", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Deletes a playlist, leaving the videos in it untouched.
+func (app *Application) DeletePlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	p, ok := app.ownedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.DB.DeletePlaylist(r.Context(), p.ID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		logger.Error("Failed to delete playlist", slog.Int64("playlist_id", p.ID), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Adds a video to a playlist. Expects a JSON body with the "video_id", and
+// optionally the "position" to insert it at, counting from 0. Videos are
+// added to the end by default.
+func (app *Application) AddPlaylistItemHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	p, ok := app.ownedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		VideoID  string `json:"video_id"`
+		Position *int   `json:"position"`
+	}
+	if err := readJSON(w, r, &input); err != nil {
+		badRequestResponse(w, err.Error())
+		return
+	}
+	if input.Position != nil && *input.Position < 0 {
+		badRequestResponse(w, "position must not be negative")
+		return
+	}
+
+	v, err := app.DB.GetVideo(r.Context(), input.VideoID)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && !app.canView(r, v)) {
+		badRequestResponse(w, "video_id must be a video you can view")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to get video", slog.String("video_id", input.VideoID), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	err = app.DB.AddPlaylistItem(r.Context(), p.ID, v.ID, input.Position)
+	switch {
+	case errors.Is(err, database.ErrConflict):
+		errorResponse(w, http.StatusConflict, "the video is already in this playlist")
+		return
+	case errors.Is(err, database.ErrPlaylistFull):
+		errorResponse(w, http.StatusConflict, fmt.Sprintf("playlists can't hold more than %d videos", database.MaxPlaylistItems))
+		return
+	case errors.Is(err, database.ErrNotFound):
+		notFoundResponse(w, r)
+		return
+	case err != nil:
+		logger.Error("Failed to add playlist item", slog.Int64("playlist_id", p.ID), slog.String("video_id", v.ID), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Moves a video within a playlist. Expects a JSON body with the new
+// "position", counting from 0.
+func (app *Application) MovePlaylistItemHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	p, ok := app.ownedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Position *int `json:"position"`
+	}
+	if err := readJSON(w, r, &input); err != nil {
+		badRequestResponse(w, err.Error())
+		return
+	}
+	if input.Position == nil || *input.Position < 0 {
+		badRequestResponse(w, "position must be provided and not negative")
+		return
+	}
+
+	err := app.DB.MovePlaylistItem(r.Context(), p.ID, routeParam(r, "video"), *input.Position)
+	if errors.Is(err, database.ErrNotFound) {
+		notFoundResponse(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to move playlist item", slog.Int64("playlist_id", p.ID), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Removes a video from a playlist.
+func (app *Application) RemovePlaylistItemHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	p, ok := app.ownedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.DB.RemovePlaylistItem(r.Context(), p.ID, routeParam(r, "video"))
+	if errors.Is(err, database.ErrNotFound) {
+		notFoundResponse(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to remove playlist item", slog.Int64("playlist_id", p.ID), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Gets the playlist named in the route, sending a 404 response if it doesn't
+// exist or is private and the request isn't from its owner or an admin.
+func (app *Application) viewablePlaylist(w http.ResponseWriter, r *http.Request) (*database.Playlist, bool) {
+	logger := logging.FromContext(r.Context())
+
+	id, err := strconv.ParseInt(routeParam(r, "id"), 10, 64)
+	if err != nil || id < 1 {
+		notFoundResponse(w, r)
+		return nil, false
+	}
+
+	p, err := app.DB.GetPlaylist(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		notFoundResponse(w, r)
+		return nil, false
+	}
+	if err != nil {
+		logger.Error("Failed to get playlist", slog.Int64("playlist_id", id), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return nil, false
+	}
+
+	if p.Visibility == database.VisibilityPrivate && !auth.HasScope(contextGetScopes(r), auth.ScopeAdmin) {
+		user := contextGetUser(r)
+		if user == nil || user.ID != p.UserID {
+			notFoundResponse(w, r)
+			return nil, false
+		}
+	}
+	return p, true
+}
+
+// Gets the playlist named in the route for changing, sending a 403 response if
+// the logged in user doesn't own it.
+func (app *Application) ownedPlaylist(w http.ResponseWriter, r *http.Request) (*database.Playlist, bool) {
+	p, ok := app.viewablePlaylist(w, r)
+	if !ok {
+		return nil, false
+	}
+	if p.UserID != contextGetUser(r).ID {
+		notPermittedResponse(w)
+		return nil, false
+	}
+	return p, true
+}
+
+// Checks a playlist's editable fields, returning a message describing the
+// first problem, or "" if they're valid.
+func validatePlaylist(p *database.Playlist) string {
+	switch {
+	case p.Title == "":
+		return "title must be provided"
+	case utf8.RuneCountInString(p.Title) > 200:
+		return "title must not be more than 200 characters long"
+	case utf8.RuneCountInString(p.Description) > 5000:
+		return "description must not be more than 5000 characters long"
+	case !slices.Contains(playlistVisibilities, p.Visibility):
+		return fmt.Sprintf("visibility must be one of %v", playlistVisibilities)
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+)
+
+// Likes a video for the logged in user. Liking a video twice has no further effect.
+func (app *Application) LikeVideoHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeLike(w, r, true)
+}
+
+// Removes the logged in user's like from a video.
+func (app *Application) UnlikeVideoHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeLike(w, r, false)
+}
+
+func (app *Application) changeLike(w http.ResponseWriter, r *http.Request, liked bool) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+	user := contextGetUser(r)
+
+	if !app.videoViewable(w, r, id) {
+		return
+	}
+
+	change := app.DB.RemoveLike
+	if liked {
+		change = app.DB.AddLike
+	}
+	count, err := change(r.Context(), user.ID, id)
+	if err != nil {
+		logger.Error("Failed to change like", slog.String("video_id", id), slog.Int64("user_id", user.ID), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	if err := writeJSON(w, http.StatusOK, envelope{"liked": liked, "like_count": count}, nil); err != nil {
+		logger.Error("Failed to return like count", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Adds a video to the logged in user's favourites.
+func (app *Application) FavouriteVideoHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+	user := contextGetUser(r)
+
+	if !app.videoViewable(w, r, id) {
+		return
+	}
+
+	if err := app.DB.AddFavourite(r.Context(), user.ID, id); err != nil {
+		logger.Error("Failed to favourite video", slog.String("video_id", id), slog.Int64("user_id", user.ID), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Removes a video from the logged in user's favourites.
+func (app *Application) UnfavouriteVideoHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+	user := contextGetUser(r)
+
+	if err := app.DB.RemoveFavourite(r.Context(), user.ID, id); err != nil {
+		logger.Error("Failed to unfavourite video", slog.String("video_id", id), slog.Int64("user_id", user.ID), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Lists the logged in user's favourite videos, most recently favourited first.
+// Favourites that have since been made private are left out.
+func (app *Application) ListFavouritesHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	user := contextGetUser(r)
+
+	favourites, err := app.DB.ListFavourites(r.Context(), user.ID)
+	if err != nil {
+		logger.Error("Failed to list favourites", slog.Int64("user_id", user.ID), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	videos := []database.Video{}
+	for _, v := range favourites {
+		if app.canView(r, &v) {
+			videos = append(videos, v)
+		}
+	}
+
+	if err := writeJSON(w, http.StatusOK, envelope{"videos": videos}, nil); err != nil {
+		logger.Error("Failed to return favourites", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
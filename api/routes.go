@@ -3,19 +3,96 @@ package api
 import (
 	"net/http"
 
+	"github.com/dantdj/goreel/auth"
+	"github.com/dantdj/goreel/metrics"
 	"github.com/julienschmidt/httprouter"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 func routes(app *Application) http.Handler {
 	router := httprouter.New()
 
-	router.NotFound = http.HandlerFunc(notFoundResponse)
-	router.MethodNotAllowed = http.HandlerFunc(methodNotAllowedResponse)
+	// Requests that don't match a route share a label, so scanners can't create
+	// unbounded series
+	router.NotFound = app.instrument("unmatched", http.HandlerFunc(notFoundResponse))
+	router.MethodNotAllowed = app.instrument("unmatched", http.HandlerFunc(methodNotAllowedResponse))
 
-	router.HandlerFunc(http.MethodGet, "/ping", app.PingHandler)
-	router.HandlerFunc(http.MethodPost, "/upload", app.VideoUploadHandler)
-	router.HandlerFunc(http.MethodGet, "/download", app.RetrieveVideoHandler)
-	router.HandlerFunc(http.MethodGet, "/process", app.ProcessVideoHandler)
+	handle := func(method, pattern string, h http.HandlerFunc) {
+		router.Handler(method, pattern, app.instrument(pattern, h))
+	}
 
-	return recoverPanic(router)
+	read := func(h http.HandlerFunc) http.HandlerFunc { return app.requireScope(auth.ScopeRead, h) }
+	upload := func(h http.HandlerFunc) http.HandlerFunc { return app.requireScope(auth.ScopeUpload, h) }
+	admin := func(h http.HandlerFunc) http.HandlerFunc { return app.requireScope(auth.ScopeAdmin, h) }
+
+	handle(http.MethodGet, "/ping", app.PingHandler)
+	handle(http.MethodGet, "/healthz", app.HealthzHandler)
+	handle(http.MethodGet, "/readyz", app.ReadyzHandler)
+	handle(http.MethodPost, "/upload", upload(app.VideoUploadHandler))
+	handle(http.MethodGet, "/download", app.signedOrRead(app.RetrieveVideoHandler))
+	handle(http.MethodGet, "/process", admin(app.ProcessVideoHandler))
+
+	handle(http.MethodGet, "/search", read(app.SearchHandler))
+	handle(http.MethodGet, "/videos", read(app.ListVideosHandler))
+	handle(http.MethodGet, "/videos/:id", read(app.ShowVideoHandler))
+	handle(http.MethodPatch, "/videos/:id", upload(app.UpdateVideoHandler))
+	handle(http.MethodDelete, "/videos/:id", upload(app.DeleteVideoHandler))
+	handle(http.MethodGet, "/videos/:id/hls/*file", app.signedOrRead(app.HLSHandler))
+	handle(http.MethodGet, "/videos/:id/audio", app.signedOrRead(app.AudioDownloadHandler))
+	handle(http.MethodGet, "/videos/:id/preview", read(app.PreviewHandler))
+	handle(http.MethodPost, "/videos/:id/clips", upload(app.CreateClipHandler))
+	if app.URLSigner != nil {
+		handle(http.MethodPost, "/videos/:id/share", upload(app.ShareVideoHandler))
+	}
+	handle(http.MethodPost, "/videos/:id/beacon", app.signedOrRead(app.PlaybackBeaconHandler))
+	handle(http.MethodGet, "/videos/:id/stats", read(app.VideoStatsHandler))
+	handle(http.MethodPut, "/videos/:id/like", app.requireUser(app.LikeVideoHandler))
+	handle(http.MethodDelete, "/videos/:id/like", app.requireUser(app.UnlikeVideoHandler))
+	handle(http.MethodPut, "/videos/:id/favourite", app.requireUser(app.FavouriteVideoHandler))
+	handle(http.MethodDelete, "/videos/:id/favourite", app.requireUser(app.UnfavouriteVideoHandler))
+	handle(http.MethodGet, "/videos/:id/comments", read(app.ListCommentsHandler))
+	handle(http.MethodPost, "/videos/:id/comments", app.requireUser(app.CreateCommentHandler))
+	handle(http.MethodGet, "/videos/:id/comments/:comment/replies", read(app.ListRepliesHandler))
+	handle(http.MethodPatch, "/videos/:id/comments/:comment", app.requireUser(app.UpdateCommentHandler))
+	handle(http.MethodDelete, "/videos/:id/comments/:comment", app.requireUser(app.DeleteCommentHandler))
+	handle(http.MethodGet, "/videos/:id/chapters", read(app.ListChaptersHandler))
+	handle(http.MethodPut, "/videos/:id/chapters", upload(app.ReplaceChaptersHandler))
+	handle(http.MethodPatch, "/videos/:id/chapters/:chapter", upload(app.UpdateChapterHandler))
+	handle(http.MethodGet, "/videos/:id/captions", read(app.ListCaptionsHandler))
+	handle(http.MethodPut, "/videos/:id/captions/:language", upload(app.PutCaptionHandler))
+	handle(http.MethodDelete, "/videos/:id/captions/:language", upload(app.DeleteCaptionHandler))
+
+	handle(http.MethodPost, "/playlists", app.requireUser(app.CreatePlaylistHandler))
+	handle(http.MethodGet, "/playlists/:id", read(app.ShowPlaylistHandler))
+	handle(http.MethodPatch, "/playlists/:id", app.requireUser(app.UpdatePlaylistHandler))
+	handle(http.MethodDelete, "/playlists/:id", app.requireUser(app.DeletePlaylistHandler))
+	handle(http.MethodGet, "/playlists/:id/items", read(app.ListPlaylistItemsHandler))
+	handle(http.MethodPost, "/playlists/:id/items", app.requireUser(app.AddPlaylistItemHandler))
+	handle(http.MethodPatch, "/playlists/:id/items/:video", app.requireUser(app.MovePlaylistItemHandler))
+	handle(http.MethodDelete, "/playlists/:id/items/:video", app.requireUser(app.RemovePlaylistItemHandler))
+
+	// Logins are only available when an OIDC provider is configured
+	if app.OIDC != nil {
+		handle(http.MethodGet, "/auth/login", app.LoginHandler)
+		handle(http.MethodGet, "/auth/callback", app.LoginCallbackHandler)
+	}
+	handle(http.MethodPost, "/auth/logout", app.LogoutHandler)
+	handle(http.MethodGet, "/users/me", app.ShowCurrentUserHandler)
+	handle(http.MethodGet, "/users/me/favourites", app.requireUser(app.ListFavouritesHandler))
+	handle(http.MethodGet, "/users/me/playlists", app.requireUser(app.ListMyPlaylistsHandler))
+
+	handle(http.MethodGet, "/admin/api-keys", admin(app.ListAPIKeysHandler))
+	handle(http.MethodPost, "/admin/api-keys", admin(app.CreateAPIKeyHandler))
+	handle(http.MethodDelete, "/admin/api-keys/:id", admin(app.RevokeAPIKeyHandler))
+	handle(http.MethodGet, "/admin/comments", admin(app.ListModerationCommentsHandler))
+	handle(http.MethodPatch, "/admin/comments/:comment", admin(app.ModerateCommentHandler))
+
+	if app.LogLevels != nil {
+		handle(http.MethodGet, "/admin/log-levels", admin(app.ShowLogLevelsHandler))
+		handle(http.MethodPatch, "/admin/log-levels", admin(app.UpdateLogLevelsHandler))
+	}
+
+	handle(http.MethodGet, "/metrics", app.requireScope(auth.ScopeMetrics, metrics.Handler().ServeHTTP))
+
+	return otelhttp.NewHandler(app.logRequests(recoverPanic(app.authenticate(router))), "http.server")
 }
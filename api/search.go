@@ -0,0 +1,109 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+)
+
+// How many of the most common tags are returned as facets with search results.
+const searchTagFacets = 20
+
+// Searches the titles, descriptions and tags of public videos, best matches
+// first. The q query parameter holds the search terms. Results can be narrowed
+// with one or more tag parameters, min_duration and max_duration in seconds,
+// and uploaded_after and uploaded_before, and are paged with page and
+// page_size. The most common tags across all matches are returned as facets.
+func (app *Application) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	qs := r.URL.Query()
+
+	filter := database.SearchFilter{
+		Query: strings.TrimSpace(qs.Get("q")),
+		Tags:  normalizeTags(qs["tag"]),
+		Page:  1,
+	}
+	switch {
+	case filter.Query == "":
+		badRequestResponse(w, "q must be provided")
+		return
+	case len(filter.Query) > 200:
+		badRequestResponse(w, "q must not be more than 200 bytes long")
+		return
+	}
+
+	limit, ok := pageSize(w, r)
+	if !ok {
+		return
+	}
+	filter.Limit = limit
+
+	if value := qs.Get("page"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 1000 {
+			badRequestResponse(w, "page must be between 1 and 1000")
+			return
+		}
+		filter.Page = n
+	}
+
+	durations := []struct {
+		name string
+		dest **float64
+	}{
+		{"min_duration", &filter.MinDuration},
+		{"max_duration", &filter.MaxDuration},
+	}
+	for _, d := range durations {
+		if value := qs.Get(d.name); value != "" {
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil || n < 0 {
+				badRequestResponse(w, fmt.Sprintf("%s must be a number of seconds", d.name))
+				return
+			}
+			*d.dest = &n
+		}
+	}
+
+	var err error
+	if filter.UploadedAfter, err = parseTimeParam(qs.Get("uploaded_after")); err != nil {
+		badRequestResponse(w, "uploaded_after must be an RFC 3339 timestamp")
+		return
+	}
+	if filter.UploadedBefore, err = parseTimeParam(qs.Get("uploaded_before")); err != nil {
+		badRequestResponse(w, "uploaded_before must be an RFC 3339 timestamp")
+		return
+	}
+
+	videos, total, err := app.DB.SearchVideos(r.Context(), filter)
+	if err != nil {
+		logger.Error("Failed to search videos", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	tags, err := app.DB.SearchTagFacets(r.Context(), filter, searchTagFacets)
+	if err != nil {
+		logger.Error("Failed to count search tags", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	metadata := map[string]any{
+		"page":          filter.Page,
+		"page_size":     filter.Limit,
+		"total_results": total,
+	}
+
+	env := envelope{"videos": videos, "facets": envelope{"tags": tags}, "metadata": metadata}
+	if err := writeJSON(w, http.StatusOK, env, nil); err != nil {
+		logger.Error("Failed to return search results", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
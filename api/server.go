@@ -6,67 +6,179 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
-	"os"
 	"os/signal"
 	"syscall"
 	"time"
+
+	"github.com/dantdj/goreel/auth"
+	"github.com/dantdj/goreel/config"
+	"github.com/dantdj/goreel/logging"
+	"github.com/dantdj/goreel/metrics"
+	"github.com/dantdj/goreel/tracing"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/sync/errgroup"
 )
 
-func Serve(port int) error {
-	app := NewApplication()
-	app.StartConsumers()
+// Run modes, chosen with the goreel subcommands.
+const (
+	// Serves the HTTP API without processing any videos
+	ModeServe = "serve"
+	// Processes videos from the queue, serving only health checks and metrics
+	ModeWorker = "worker"
+	// Does both in one process
+	ModeAll = "all"
+)
 
-	// Define the server object with some sensible timeout defaults to prevent lingering connections
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", port),
-		Handler:      routes(app),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+// Runs the service in the given mode until it receives SIGINT or SIGTERM, then
+// shuts down gracefully: the API stops taking requests and flushes buffered
+// playback stats, and the worker stops taking jobs and waits for running ones.
+func Run(mode string, cfg *config.Config, logLevels *logging.Levels) error {
+	shutdownTracing, err := tracing.Setup(context.Background(), "goreel-"+mode, cfg.Tracing.Enabled)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+
+	app := NewApplication(cfg)
+	app.Mode = mode
+	app.LogLevels = logLevels
+	defer app.DB.Close()
+	defer app.RabbitClient.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	g, ctx := errgroup.WithContext(ctx)
+
+	if mode == ModeServe || mode == ModeAll {
+		g.Go(func() error { return app.serveAPI(ctx) })
 	}
 
-	// Channel to receive any errors returned by Shutdown()
-	shutdownError := make(chan error)
+	if mode == ModeWorker || mode == ModeAll {
+		if err := app.StartConsumers(); err != nil {
+			// Failing the group shuts down the API too, if it's already started
+			g.Go(func() error { return fmt.Errorf("failed to start consumers: %w", err) })
+		} else {
+			g.Go(func() error { return app.stopWorkerOnDone(ctx) })
+			g.Go(func() error {
+				app.resumeStalledDeletes(ctx)
+				return nil
+			})
+
+			// The API serves these itself, so a separate port is only needed when
+			// the worker runs on its own
+			if mode == ModeWorker {
+				srv := app.newServer(cfg.Worker.Port, workerRoutes(app))
+				g.Go(func() error { return serveHTTP(ctx, srv, cfg.HTTP.ShutdownTimeout) })
+			}
+		}
+	}
 
+	err = g.Wait()
+
+	// Send off any spans still waiting to be exported
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if flushErr := shutdownTracing(flushCtx); flushErr != nil {
+		slog.Error("Failed to flush traces", slog.String("error", flushErr.Error()))
+	}
+
+	return err
+}
+
+// Serves the API until ctx is done, then writes out any buffered playback stats
+// once the last requests have finished.
+func (app *Application) serveAPI(ctx context.Context) error {
+	statsCtx, stopStats := context.WithCancel(context.Background())
+	statsDone := make(chan struct{})
 	go func() {
-		quit := make(chan os.Signal, 1)
-		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		app.Stats.Run(statsCtx)
+		close(statsDone)
+	}()
+
+	err := serveHTTP(ctx, app.newServer(app.Config.HTTP.Port, routes(app)), app.Config.HTTP.ShutdownTimeout)
 
-		// Blocks until a signal is received
-		s := <-quit
+	slog.Info("Completing background tasks...")
+	stopStats()
+	<-statsDone
 
-		slog.Info("Shutting down server", slog.String("receivedSignal", s.String()))
+	return err
+}
 
-		// Give a 5 second grace timeout for in-flight requests to finish
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+// Waits for ctx to be done, then stops consuming jobs and gives the ones
+// already running time to finish.
+func (app *Application) stopWorkerOnDone(ctx context.Context) error {
+	<-ctx.Done()
 
-		err := srv.Shutdown(ctx)
-		if err != nil {
-			shutdownError <- err
-		}
+	slog.Info("Stopping worker, waiting for running jobs", slog.Duration("timeout", app.Config.Worker.ShutdownTimeout))
 
-		slog.Info("Completing background tasks...")
+	waitCtx, cancel := context.WithTimeout(context.Background(), app.Config.Worker.ShutdownTimeout)
+	defer cancel()
+	if err := app.RabbitClient.StopConsumers(waitCtx); err != nil {
+		// The jobs are interrupted, and their messages requeued for another worker
+		slog.Error("Gave up waiting for running jobs", slog.String("error", err.Error()))
+		return nil
+	}
+
+	slog.Info("Stopped worker")
+	return nil
+}
+
+// Returns a server with some sensible timeout defaults to prevent lingering connections.
+func (app *Application) newServer(port int, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         fmt.Sprintf(":%d", port),
+		Handler:      handler,
+		IdleTimeout:  app.Config.HTTP.IdleTimeout,
+		ReadTimeout:  app.Config.HTTP.ReadTimeout,
+		WriteTimeout: app.Config.HTTP.WriteTimeout,
+	}
+}
 
-		// Indicate shutdown finished with no issues - we're waiting on this down below!
-		shutdownError <- nil
+// Serves HTTP until ctx is done, then gives in-flight requests up to timeout
+// to finish.
+func serveHTTP(ctx context.Context, srv *http.Server, timeout time.Duration) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Starting server", slog.String("address", srv.Addr))
+		serveErr <- srv.ListenAndServe()
 	}()
 
-	slog.Info("Starting server", slog.String("address", srv.Addr))
+	select {
+	case err := <-serveErr:
+		// The server never got going, e.g. because the port is in use
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down server", slog.String("address", srv.Addr))
 
-	// Calling Shutdown causes an ErrServerClosed error to be thrown - if the error
-	// is anything _but_ that, then we want to return. Otherwise, proceed with shutdown
-	err := srv.ListenAndServe()
-	if !errors.Is(err, http.ErrServerClosed) {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
 		return err
 	}
 
-	err = <-shutdownError
-	if err != nil {
+	// Calling Shutdown causes ListenAndServe to return ErrServerClosed - anything
+	// else is a genuine failure
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
 
 	slog.Info("Stopped server", slog.String("address", srv.Addr))
-
 	return nil
 }
+
+// Routes served by a standalone worker. The health checks aren't authenticated,
+// so the worker port should only be reachable from inside the cluster, while
+// metrics need the metrics scope, just as they do on the API.
+func workerRoutes(app *Application) http.Handler {
+	router := httprouter.New()
+
+	router.NotFound = http.HandlerFunc(notFoundResponse)
+	router.MethodNotAllowed = http.HandlerFunc(methodNotAllowedResponse)
+
+	router.HandlerFunc(http.MethodGet, "/healthz", app.HealthzHandler)
+	router.HandlerFunc(http.MethodGet, "/readyz", app.ReadyzHandler)
+	router.Handler(http.MethodGet, "/metrics", app.authenticate(app.requireScope(auth.ScopeMetrics, metrics.Handler().ServeHTTP)))
+
+	return recoverPanic(router)
+}
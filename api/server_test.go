@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServeHTTP_ShutsDownWhenDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+
+	done := make(chan error, 1)
+	go func() { done <- serveHTTP(ctx, srv, time.Second) }()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't shut down")
+	}
+}
+
+func TestServeHTTP_ReportsListenErrors(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer listener.Close()
+
+	srv := &http.Server{Addr: listener.Addr().String(), Handler: http.NotFoundHandler()}
+	if err := serveHTTP(context.Background(), srv, time.Second); err == nil {
+		t.Error("expected an error serving on a port that's in use")
+	}
+}
+
+func TestWorkerRoutes(t *testing.T) {
+	handler := workerRoutes(&Application{})
+
+	tests := map[string]int{
+		"/healthz": http.StatusOK,
+		"/metrics": http.StatusUnauthorized,
+		"/videos":  http.StatusNotFound,
+	}
+	for path, expected := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != expected {
+			t.Errorf("GET %s: expected %d, got %d", path, expected, w.Code)
+		}
+	}
+}
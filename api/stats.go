@@ -0,0 +1,130 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dantdj/goreel/logging"
+)
+
+const (
+	// The most watch time a single heartbeat can report. The recorder also caps
+	// each heartbeat at the time since the viewer's last one, so sending them
+	// faster doesn't inflate the totals.
+	maxHeartbeatSeconds = 60
+)
+
+// Records playback events sent by the player. Expects a JSON body with an
+// "event" of "view", sent when playback starts, or "heartbeat", sent
+// periodically during playback with the "seconds" watched since the last one.
+// An optional "session_id" generated by the player tells apart anonymous viewers
+// sharing an address.
+func (app *Application) PlaybackBeaconHandler(w http.ResponseWriter, r *http.Request) {
+	id := routeParam(r, "id")
+
+	var input struct {
+		Event     string  `json:"event"`
+		SessionID string  `json:"session_id"`
+		Seconds   float64 `json:"seconds"`
+	}
+	if err := readJSON(w, r, &input); err != nil {
+		badRequestResponse(w, err.Error())
+		return
+	}
+
+	switch {
+	case input.Event != "view" && input.Event != "heartbeat":
+		badRequestResponse(w, `event must be "view" or "heartbeat"`)
+		return
+	case len(input.SessionID) > 128:
+		badRequestResponse(w, "session_id must not be more than 128 characters long")
+		return
+	case input.Event == "heartbeat" && (input.Seconds <= 0 || input.Seconds > maxHeartbeatSeconds):
+		badRequestResponse(w, "seconds must be more than 0 and at most 60")
+		return
+	}
+
+	if !app.videoViewable(w, r, id) {
+		return
+	}
+
+	now := time.Now()
+	viewer := viewerKey(r, input.SessionID)
+	if input.Event == "view" {
+		app.Stats.RecordView(id, viewer, now)
+	} else {
+		app.Stats.RecordWatchTime(id, viewer, input.Seconds, now)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Returns a video's view count, watch time and like count, along with its
+// daily views and watch time. An optional "days" query parameter sets how
+// many days of history to include, defaulting to 30. Recent playback may take
+// a few seconds to show up, as it's written in batches.
+func (app *Application) VideoStatsHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+
+	days := 30
+	if value := r.URL.Query().Get("days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 366 {
+			badRequestResponse(w, "days must be a whole number between 1 and 366")
+			return
+		}
+		days = n
+	}
+
+	v, ok := app.viewableVideo(w, r, id)
+	if !ok {
+		return
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -(days - 1))
+	daily, err := app.DB.ListDailyStats(r.Context(), id, since)
+	if err != nil {
+		logger.Error("Failed to list daily stats", slog.String("video_id", id), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	env := envelope{"stats": envelope{
+		"view_count":    v.ViewCount,
+		"watch_seconds": v.WatchSeconds,
+		"like_count":    v.LikeCount,
+		"daily":         daily,
+	}}
+	if err := writeJSON(w, http.StatusOK, env, nil); err != nil {
+		logger.Error("Failed to return stats", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Identifies the viewer for deduplicating views and capping watch time: the
+// logged in user if there is one, otherwise the client's address along with
+// the player's session or, without one, the user agent. Sessions are chosen by
+// the client, so they only tell apart viewers sharing an address. The result is
+// hashed so raw addresses aren't stored.
+//
+// Viewers are tracked in each instance's memory, so with several API instances
+// a viewer can be counted once by each of them.
+func viewerKey(r *http.Request, sessionId string) string {
+	var key string
+	switch {
+	case contextGetUser(r) != nil:
+		key = "user:" + contextGetUser(r).OwnerID()
+	case sessionId != "":
+		key = "session:" + clientIP(r) + "|" + sessionId
+	default:
+		key = "client:" + clientIP(r) + "|" + r.UserAgent()
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
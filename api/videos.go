@@ -0,0 +1,282 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+	"github.com/dantdj/goreel/video"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var videoVisibilities = []string{
+	database.VisibilityPublic,
+	database.VisibilityUnlisted,
+	database.VisibilityPrivate,
+}
+
+var videoStatuses = []string{
+	database.VideoStatusUploaded,
+	database.VideoStatusProcessing,
+	database.VideoStatusReady,
+	database.VideoStatusFailed,
+}
+
+// Lists the video catalog a page at a time. Supports filtering with the status,
+// owner, tag, created_after and created_before query parameters, ordering with
+// sort, and paging with cursor and page_size.
+func (app *Application) ListVideosHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	qs := r.URL.Query()
+
+	filter := database.VideoFilter{
+		Status: qs.Get("status"),
+		// Unlisted and private videos never appear in the catalog
+		Visibility: database.VisibilityPublic,
+		OwnerID:    qs.Get("owner"),
+		Tag:        qs.Get("tag"),
+		Sort:       qs.Get("sort"),
+		Cursor:     qs.Get("cursor"),
+	}
+	if filter.Sort == "" {
+		filter.Sort = "-created_at"
+	}
+
+	if filter.Status != "" && !slices.Contains(videoStatuses, filter.Status) {
+		badRequestResponse(w, fmt.Sprintf("status must be one of %v", videoStatuses))
+		return
+	}
+	if !slices.Contains(database.VideoSortSafelist, filter.Sort) {
+		badRequestResponse(w, fmt.Sprintf("sort must be one of %v", database.VideoSortSafelist))
+		return
+	}
+	limit, ok := pageSize(w, r)
+	if !ok {
+		return
+	}
+	filter.Limit = limit
+
+	var err error
+	if filter.CreatedAfter, err = parseTimeParam(qs.Get("created_after")); err != nil {
+		badRequestResponse(w, "created_after must be an RFC 3339 timestamp")
+		return
+	}
+	if filter.CreatedBefore, err = parseTimeParam(qs.Get("created_before")); err != nil {
+		badRequestResponse(w, "created_before must be an RFC 3339 timestamp")
+		return
+	}
+
+	videos, nextCursor, err := app.DB.ListVideos(r.Context(), filter)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		badRequestResponse(w, "cursor is invalid, or was issued for a different sort")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to list videos", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	metadata := pageMetadata(filter.Limit, nextCursor)
+	metadata["sort"] = filter.Sort
+
+	if err := writeJSON(w, http.StatusOK, envelope{"videos": videos, "metadata": metadata}, nil); err != nil {
+		logger.Error("Failed to return videos", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Shows a video. For logged in users, the response also says whether they've
+// liked and favourited it.
+func (app *Application) ShowVideoHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+
+	v, ok := app.viewableVideo(w, r, id)
+	if !ok {
+		return
+	}
+
+	env := envelope{"video": v}
+	if user := contextGetUser(r); user != nil {
+		liked, favourited, err := app.DB.GetReactions(r.Context(), user.ID, id)
+		if err != nil {
+			logger.Error("Failed to get reactions", slog.String("video_id", id), slog.String("error", err.Error()))
+			serverErrorResponse(w)
+			return
+		}
+		env["reactions"] = envelope{"liked": liked, "favourited": favourited}
+	}
+
+	if err := writeJSON(w, http.StatusOK, env, nil); err != nil {
+		logger.Error("Failed to return video", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Parses an optional RFC 3339 query parameter, returning nil if it's empty.
+func parseTimeParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Updates a video's title, description, tags and/or visibility. Fields left out
+// of the JSON body are unchanged.
+func (app *Application) UpdateVideoHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+
+	var input struct {
+		Title       *string   `json:"title"`
+		Description *string   `json:"description"`
+		Tags        *[]string `json:"tags"`
+		Visibility  *string   `json:"visibility"`
+	}
+	if err := readJSON(w, r, &input); err != nil {
+		badRequestResponse(w, err.Error())
+		return
+	}
+
+	v, ok := app.editableVideo(w, r, id)
+	if !ok {
+		return
+	}
+
+	if input.Title != nil {
+		v.Title = strings.TrimSpace(*input.Title)
+	}
+	if input.Description != nil {
+		v.Description = strings.TrimSpace(*input.Description)
+	}
+	if input.Tags != nil {
+		v.Tags = normalizeTags(*input.Tags)
+	}
+	if input.Visibility != nil {
+		v.Visibility = *input.Visibility
+	}
+
+	if message := validateVideoMetadata(v); message != "" {
+		badRequestResponse(w, message)
+		return
+	}
+
+	err := app.DB.UpdateVideoMetadata(r.Context(), v)
+	if errors.Is(err, database.ErrNotFound) {
+		notFoundResponse(w, r)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to update video", slog.String("video_id", id), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	logger.Info("Updated video", slog.String("video_id", id))
+
+	if err := writeJSON(w, http.StatusOK, envelope{"video": v}, nil); err != nil {
+		logger.Error("Failed to return video", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Flags a video for deletion and queues a job to remove it. The video disappears
+// from the API straight away, but its owner or an admin can repeat the request
+// until it's gone, e.g. to retry after a timeout, and the job is queued again.
+func (app *Application) DeleteVideoHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	id := routeParam(r, "id")
+
+	v, err := app.DB.GetDeletingVideo(r.Context(), id)
+	switch {
+	case err == nil:
+		// Already flagged by an earlier request
+		if !app.canEdit(r, v) {
+			notFoundResponse(w, r)
+			return
+		}
+	case errors.Is(err, database.ErrNotFound):
+		if _, ok := app.editableVideo(w, r, id); !ok {
+			return
+		}
+		err := app.DB.MarkVideoDeleting(r.Context(), id)
+		if errors.Is(err, database.ErrNotFound) {
+			notFoundResponse(w, r)
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to mark video for deletion", slog.String("video_id", id), slog.String("error", err.Error()))
+			serverErrorResponse(w)
+			return
+		}
+	default:
+		logger.Error("Failed to get video", slog.String("video_id", id), slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	if err := app.enqueue(r.Context(), video.Job{Type: video.JobTypeDelete, VideoID: id}); err != nil {
+		// The video stays flagged, and a worker queues the delete again once it has stalled
+		logger.Error("Failed to publish message to RabbitMQ", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+		return
+	}
+
+	logger.Info("Queued video deletion", slog.String("video_id", id))
+
+	if err := writeJSON(w, http.StatusAccepted, envelope{"message": "video deletion has been queued"}, nil); err != nil {
+		logger.Error("Failed to return deletion status", slog.String("error", err.Error()))
+		serverErrorResponse(w)
+	}
+}
+
+// Trims, lowercases and de-duplicates tags, dropping any that end up empty.
+func normalizeTags(tags []string) []string {
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// Returns a message describing what's wrong with the video's metadata, or an empty string if it's valid.
+func validateVideoMetadata(v *database.Video) string {
+	switch {
+	case len(v.Title) > 200:
+		return "title must not be more than 200 bytes long"
+	case len(v.Description) > 5000:
+		return "description must not be more than 5000 bytes long"
+	case len(v.Tags) > 20:
+		return "a video must not have more than 20 tags"
+	case !slices.Contains(videoVisibilities, v.Visibility):
+		return fmt.Sprintf("visibility must be one of %v", videoVisibilities)
+	}
+	for _, tag := range v.Tags {
+		if len(tag) > 50 {
+			return "tags must not be more than 50 bytes long"
+		}
+	}
+	return ""
+}
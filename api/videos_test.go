@@ -0,0 +1,13 @@
+package api
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tags := normalizeTags([]string{" Music ", "music", "", "LIVE"})
+	if expected := []string{"music", "live"}; !slices.Equal(tags, expected) {
+		t.Errorf("expected %v, got %v", expected, tags)
+	}
+}
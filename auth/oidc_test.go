@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// A minimal OIDC issuer that hands out ID tokens for a single user, checking
+// the PKCE verifier against the challenge sent at the start of the login.
+type mockIssuer struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	m := &mockIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                m.server.URL,
+			"authorization_endpoint":                m.server.URL + "/authorize",
+			"token_endpoint":                        m.server.URL + "/token",
+			"jwks_uri":                              m.server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &m.key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     m.idToken(t),
+		})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockIssuer) idToken(t *testing.T) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: m.key},
+		(&jose.SignerOptions{}).WithHeader("kid", "test"))
+	if err != nil {
+		t.Fatalf("error creating signer: %v", err)
+	}
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   m.server.URL,
+		"sub":   "user-1",
+		"aud":   "goreel",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": m.nonce,
+		"email": "user@example.com",
+		"name":  "Test User",
+	})
+	jws, err := signer.Sign(claims)
+	if err != nil {
+		t.Fatalf("error signing token: %v", err)
+	}
+	token, err := jws.CompactSerialize()
+	if err != nil {
+		t.Fatalf("error serializing token: %v", err)
+	}
+	return token
+}
+
+// Starts a login against the mock issuer, recording the challenge and nonce
+// it would have been given.
+func startLogin(t *testing.T, m *mockIssuer, o *OIDC, verifier string) {
+	authURL, err := url.Parse(o.AuthCodeURL("state", "nonce", verifier))
+	if err != nil {
+		t.Fatalf("error parsing auth URL: %v", err)
+	}
+	query := authURL.Query()
+	if got := query.Get("code_challenge_method"); got != "S256" {
+		t.Fatalf("expected S256 code challenge method, got %q", got)
+	}
+	m.challenge = query.Get("code_challenge")
+	m.nonce = query.Get("nonce")
+}
+
+func TestOIDC_Exchange(t *testing.T) {
+	m := newMockIssuer(t)
+	o, err := NewOIDC(context.Background(), m.server.URL, "goreel", "secret", "http://localhost/auth/callback")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	verifier := NewCodeVerifier()
+	startLogin(t, m, o, verifier)
+
+	identity, err := o.Exchange(context.Background(), "code", verifier, "nonce")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Identity{Issuer: m.server.URL, Subject: "user-1", Email: "user@example.com", Name: "Test User"}
+	if *identity != want {
+		t.Errorf("expected %+v, got %+v", want, *identity)
+	}
+}
+
+func TestOIDC_ExchangeWrongVerifier(t *testing.T) {
+	m := newMockIssuer(t)
+	o, err := NewOIDC(context.Background(), m.server.URL, "goreel", "secret", "http://localhost/auth/callback")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	startLogin(t, m, o, NewCodeVerifier())
+
+	if _, err := o.Exchange(context.Background(), "code", NewCodeVerifier(), "nonce"); err == nil {
+		t.Fatal("expected an error for a mismatched code verifier")
+	}
+}
+
+func TestOIDC_ExchangeWrongNonce(t *testing.T) {
+	m := newMockIssuer(t)
+	o, err := NewOIDC(context.Background(), m.server.URL, "goreel", "secret", "http://localhost/auth/callback")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	verifier := NewCodeVerifier()
+	startLogin(t, m, o, verifier)
+
+	if _, err := o.Exchange(context.Background(), "code", verifier, "other-nonce"); err == nil {
+		t.Fatal("expected an error for a mismatched nonce")
+	}
+}
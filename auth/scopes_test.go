@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+func signJWT(t *testing.T, secret []byte, claims any) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: secret}, nil)
+	if err != nil {
+		t.Fatalf("error creating signer: %v", err)
+	}
+	token, err := jwt.Signed(signer).Claims(claims).Serialize()
+	if err != nil {
+		t.Fatalf("error signing token: %v", err)
+	}
+	return token
+}
+
+func TestParseJWT(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	expiry := jwt.NewNumericDate(time.Now().Add(time.Hour))
+
+	token := signJWT(t, secret, map[string]any{"sub": "ci", "exp": expiry, "scope": "upload read"})
+	claims, err := ParseJWT(secret, token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Subject != "ci" {
+		t.Errorf("expected subject ci, got %q", claims.Subject)
+	}
+	if len(claims.Scopes) != 2 || claims.Scopes[0] != ScopeUpload || claims.Scopes[1] != ScopeRead {
+		t.Errorf("expected upload and read scopes, got %v", claims.Scopes)
+	}
+
+	tests := map[string]string{
+		"wrong secret": signJWT(t, []byte("fedcba9876543210fedcba9876543210"), map[string]any{"exp": expiry}),
+		"expired":      signJWT(t, secret, map[string]any{"exp": jwt.NewNumericDate(time.Now().Add(-time.Hour))}),
+		"no expiry":    signJWT(t, secret, map[string]any{"scope": "admin"}),
+		"malformed":    "not-a-token",
+	}
+	for name, token := range tests {
+		if _, err := ParseJWT(secret, token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	if !HasScope([]string{ScopeRead}, ScopeRead) {
+		t.Error("expected read to allow read")
+	}
+	if HasScope([]string{ScopeRead}, ScopeUpload) {
+		t.Error("expected read not to allow upload")
+	}
+	if !HasScope([]string{ScopeAdmin}, ScopeUpload) {
+		t.Error("expected admin to allow upload")
+	}
+}
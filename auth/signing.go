@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Query parameters carried by a signed URL.
+const (
+	signedExpiresParam = "expires"
+	signedIPParam      = "ip"
+	signedSigParam     = "sig"
+)
+
+var (
+	// ErrSignatureInvalid is returned when a signed URL has been tampered with,
+	// or was signed for a different video or client.
+	ErrSignatureInvalid = errors.New("invalid URL signature")
+	// ErrSignatureExpired is returned when a signed URL is past its expiry.
+	ErrSignatureExpired = errors.New("URL signature has expired")
+)
+
+// URLSigner signs and verifies time-limited playback URLs with HMAC-SHA256.
+// A signature covers every file belonging to one video, so the same query can
+// be appended to a playlist and each of the segments it lists.
+type URLSigner struct {
+	secret []byte
+}
+
+func NewURLSigner(secret []byte) *URLSigner {
+	return &URLSigner{secret: secret}
+}
+
+// Returns the query parameters granting access to a video until the expiry.
+// If clientIP is set, only that client can use them.
+func (s *URLSigner) Sign(videoId string, expires time.Time, clientIP string) url.Values {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+
+	query := url.Values{}
+	query.Set(signedExpiresParam, exp)
+	if clientIP != "" {
+		query.Set(signedIPParam, clientIP)
+	}
+	query.Set(signedSigParam, s.signature(videoId, exp, clientIP))
+	return query
+}
+
+// Checks that the query carries a valid, unexpired signature for the video,
+// and that it was bound to the given client IP, if it was bound at all.
+func (s *URLSigner) Verify(videoId string, query url.Values, clientIP string, now time.Time) error {
+	exp := query.Get(signedExpiresParam)
+	boundIP := query.Get(signedIPParam)
+
+	sig, err := base64.RawURLEncoding.DecodeString(query.Get(signedSigParam))
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	want, _ := base64.RawURLEncoding.DecodeString(s.signature(videoId, exp, boundIP))
+	if !hmac.Equal(sig, want) {
+		return ErrSignatureInvalid
+	}
+
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	if now.Unix() > expires {
+		return ErrSignatureExpired
+	}
+
+	if boundIP != "" && !sameIP(boundIP, clientIP) {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
+
+// Reports whether the query is trying to use a signature, whether or not it's valid.
+func IsSigned(query url.Values) bool {
+	return query.Has(signedSigParam)
+}
+
+// Returns only the signing parameters from a query, so they can be passed on
+// to the URIs in a playlist.
+func SignedParams(query url.Values) url.Values {
+	signed := url.Values{}
+	for _, name := range []string{signedExpiresParam, signedIPParam, signedSigParam} {
+		if query.Has(name) {
+			signed.Set(name, query.Get(name))
+		}
+	}
+	return signed
+}
+
+func (s *URLSigner) signature(videoId, expires, clientIP string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(videoId + "\n" + expires + "\n" + clientIP))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func sameIP(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	return ipA != nil && ipA.Equal(ipB)
+}
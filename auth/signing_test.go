@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestURLSigner_Verify(t *testing.T) {
+	signer := NewURLSigner([]byte("0123456789abcdef0123456789abcdef"))
+	now := time.Unix(1_700_000_000, 0)
+	expires := now.Add(time.Hour)
+
+	query := signer.Sign("abc", expires, "")
+	if err := signer.Verify("abc", query, "203.0.113.9", now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := signer.Verify("other", query, "203.0.113.9", now); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("expected ErrSignatureInvalid for another video, got %v", err)
+	}
+	if err := signer.Verify("abc", query, "203.0.113.9", expires.Add(time.Second)); !errors.Is(err, ErrSignatureExpired) {
+		t.Errorf("expected ErrSignatureExpired, got %v", err)
+	}
+
+	tampered := signer.Sign("abc", expires, "")
+	tampered.Set("expires", "9999999999")
+	if err := signer.Verify("abc", tampered, "203.0.113.9", now); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("expected ErrSignatureInvalid for a changed expiry, got %v", err)
+	}
+
+	bound := signer.Sign("abc", expires, "203.0.113.9")
+	if err := signer.Verify("abc", bound, "203.0.113.9", now); err != nil {
+		t.Errorf("unexpected error for the bound client: %v", err)
+	}
+	if err := signer.Verify("abc", bound, "198.51.100.1", now); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("expected ErrSignatureInvalid for another client, got %v", err)
+	}
+	bound.Del("ip")
+	if err := signer.Verify("abc", bound, "198.51.100.1", now); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("expected ErrSignatureInvalid with the IP stripped, got %v", err)
+	}
+}
@@ -0,0 +1,318 @@
+// Package config loads the service's settings into a typed struct. Each setting
+// is named after its environment variable, and can also be set in a JSON config
+// file using the same names, or with a command-line flag. Flags take precedence
+// over the environment, which takes precedence over the file.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dantdj/goreel/logging"
+)
+
+// Config holds every setting the service reads.
+type Config struct {
+	// Local development mode, which logs to stdout and allows insecure cookies
+	Local bool
+
+	HTTP       HTTPConfig
+	Database   DatabaseConfig
+	Storage    StorageConfig
+	Queue      QueueConfig
+	Worker     WorkerConfig
+	Video      VideoConfig
+	Auth       AuthConfig
+	Moderation ModerationConfig
+	Stats      StatsConfig
+	Log        LogConfig
+	Tracing    TracingConfig
+}
+
+type HTTPConfig struct {
+	Port            int
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+	MaxUploadBytes  int64
+}
+
+type DatabaseConfig struct {
+	URL Secret
+}
+
+type StorageConfig struct {
+	ConnectionString Secret
+	AccountName      string
+	Container        string
+}
+
+type QueueConfig struct {
+	URL  Secret
+	Name string
+	// How many messages are processed at once
+	Prefetch int
+}
+
+type WorkerConfig struct {
+	// Serves health checks and metrics when running as a worker on its own
+	Port int
+	// How long in-flight jobs get to finish on shutdown
+	ShutdownTimeout time.Duration
+}
+
+type VideoConfig struct {
+	// Optional JSON file of encoding profiles
+	ProfilesFile string
+	// Working directory for downloads and transcoded output
+	TempDir string
+}
+
+type AuthConfig struct {
+	// Logins are disabled unless all of the OIDC settings are given
+	OIDCIssuerURL    string
+	OIDCClientID     string
+	OIDCClientSecret Secret
+	OIDCRedirectURL  string
+	// Empty disables JWTs
+	JWTSecret Secret
+	// Empty disables signed URLs
+	URLSigningSecret Secret
+}
+
+type ModerationConfig struct {
+	// Optional file of words and phrases that hold comments for review
+	BannedWordsFile string
+}
+
+type StatsConfig struct {
+	ViewDedupWindow time.Duration
+	FlushInterval   time.Duration
+}
+
+type LogConfig struct {
+	Level          slog.Level
+	PackageLevels  map[string]slog.Level
+	Format         string
+	Sinks          []string
+	File           string
+	FileMaxBytes   int64
+	FileMaxBackups int
+	AxiomToken     Secret
+	AxiomOrgID     string
+	AxiomDataset   string
+}
+
+type TracingConfig struct {
+	// Set when an OTLP endpoint is configured. The exporter reads the rest of
+	// its settings from the standard OTEL_EXPORTER_OTLP_* variables itself.
+	Enabled bool
+}
+
+// Returns the settings for the logging package.
+func (c LogConfig) Logging() logging.Config {
+	return logging.Config{
+		Level:          c.Level,
+		PackageLevels:  c.PackageLevels,
+		Format:         c.Format,
+		Sinks:          c.Sinks,
+		File:           c.File,
+		FileMaxBytes:   c.FileMaxBytes,
+		FileMaxBackups: c.FileMaxBackups,
+		AxiomToken:     c.AxiomToken.Value(),
+		AxiomOrgID:     c.AxiomOrgID,
+		AxiomDataset:   c.AxiomDataset,
+	}
+}
+
+// Every setting that can be given, with its description for -help.
+var settings = []struct {
+	key   string
+	usage string
+}{
+	{"GOREEL_LOCAL", "run in local development mode (true or false)"},
+	{"GOREEL_HTTP_PORT", "port to serve HTTP on"},
+	{"GOREEL_HTTP_READ_TIMEOUT", "maximum time to read a request"},
+	{"GOREEL_HTTP_WRITE_TIMEOUT", "maximum time to write a response"},
+	{"GOREEL_HTTP_IDLE_TIMEOUT", "how long idle keep-alive connections are kept open"},
+	{"GOREEL_SHUTDOWN_TIMEOUT", "grace period for in-flight requests on shutdown"},
+	{"GOREEL_MAX_UPLOAD_MB", "largest upload accepted, in MiB"},
+	{"DATABASE_URL", "Postgres connection URL"},
+	{"AZURE_STORAGE_CONNECTION_STRING", "Azure Blob Storage connection string"},
+	{"AZURE_STORAGE_ACCOUNT_NAME", "Azure storage account name, used in blob URLs"},
+	{"AZURE_STORAGE_CONTAINER_NAME", "Azure storage container for videos"},
+	{"RABBITMQ_URL", "RabbitMQ connection URL"},
+	{"GOREEL_QUEUE_NAME", "queue that video jobs are sent through"},
+	{"GOREEL_QUEUE_PREFETCH", "how many video jobs are run at once"},
+	{"GOREEL_WORKER_PORT", "port the worker serves health checks and metrics on"},
+	{"GOREEL_WORKER_SHUTDOWN_TIMEOUT", "how long the worker waits for running jobs on shutdown"},
+	{"GOREEL_PROFILES_FILE", "JSON file of encoding profiles"},
+	{"GOREEL_TEMP_DIR", "working directory for video processing"},
+	{"GOREEL_BANNED_WORDS_FILE", "file of words and phrases that hold comments for review"},
+	{"OIDC_ISSUER_URL", "OpenID Connect issuer URL"},
+	{"OIDC_CLIENT_ID", "OpenID Connect client ID"},
+	{"OIDC_CLIENT_SECRET", "OpenID Connect client secret"},
+	{"OIDC_REDIRECT_URL", "OpenID Connect redirect URL, ending in /auth/callback"},
+	{"GOREEL_JWT_SECRET", "secret for HS256 bearer JWTs, at least 32 bytes"},
+	{"GOREEL_URL_SIGNING_SECRET", "secret for signed playback URLs, at least 32 bytes"},
+	{"GOREEL_VIEW_DEDUP_WINDOW", "how long repeat views from a viewer are ignored"},
+	{"GOREEL_STATS_FLUSH_INTERVAL", "how often buffered playback stats are written"},
+	{"GOREEL_LOG_LEVEL", "minimum log level"},
+	{"GOREEL_LOG_PACKAGE_LEVELS", "per-package log levels, as package=level pairs separated by commas"},
+	{"GOREEL_LOG_FORMAT", "log format for stdout and file sinks, json or text"},
+	{"GOREEL_LOG_SINKS", "comma-separated log sinks: stdout, file and/or axiom"},
+	{"GOREEL_LOG_FILE", "path of the file log sink"},
+	{"GOREEL_LOG_FILE_MAX_MB", "size the log file is rotated at, in MiB"},
+	{"GOREEL_LOG_FILE_MAX_BACKUPS", "number of rotated log files kept"},
+	{"AXIOM_TOKEN", "Axiom personal token"},
+	{"AXIOM_ORG_ID", "Axiom organization ID"},
+	{"AXIOM_DATASET", "Axiom dataset logs are sent to"},
+}
+
+// Returns the command-line flag name for a setting, e.g. GOREEL_HTTP_PORT
+// becomes http-port.
+func flagName(key string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(key, "GOREEL_")), "_", "-")
+}
+
+// Loads the settings from the given command-line arguments, the environment
+// and the config file named by -config or GOREEL_CONFIG_FILE, then validates
+// them. Every problem found is reported, rather than just the first.
+func Load(name string, args []string) (*Config, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("GOREEL_CONFIG_FILE"), "JSON config file, using the environment variable names as keys")
+	for _, s := range settings {
+		fs.String(flagName(s.key), "", fmt.Sprintf("%s (%s)", s.usage, s.key))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	src := source{flags: map[string]string{}}
+	fs.Visit(func(f *flag.Flag) {
+		src.flags[f.Name] = f.Value.String()
+	})
+	if *configFile != "" {
+		file, err := readFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		src.file = file
+	}
+
+	cfg := src.parse()
+	if err := errors.Join(append(src.errs, cfg.Validate())...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Reads a JSON config file of setting names to values. Values can be strings,
+// numbers or booleans.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	known := map[string]bool{}
+	for _, s := range settings {
+		known[s.key] = true
+	}
+
+	values := map[string]string{}
+	var errs []error
+	for key, value := range raw {
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("config file %s: unknown setting %s", path, key))
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			values[key] = v
+		case float64:
+			values[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			values[key] = strconv.FormatBool(v)
+		default:
+			errs = append(errs, fmt.Errorf("config file %s: %s must be a string, number or boolean", path, key))
+		}
+	}
+	return values, errors.Join(errs...)
+}
+
+// Checks the settings make sense together, returning every problem found.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.HTTP.Port > 0 && c.HTTP.Port < 65536, "GOREEL_HTTP_PORT must be between 1 and 65535")
+	check(c.HTTP.ReadTimeout > 0, "GOREEL_HTTP_READ_TIMEOUT must be positive")
+	check(c.HTTP.WriteTimeout > 0, "GOREEL_HTTP_WRITE_TIMEOUT must be positive")
+	check(c.HTTP.IdleTimeout > 0, "GOREEL_HTTP_IDLE_TIMEOUT must be positive")
+	check(c.HTTP.ShutdownTimeout > 0, "GOREEL_SHUTDOWN_TIMEOUT must be positive")
+	check(c.HTTP.MaxUploadBytes > 0, "GOREEL_MAX_UPLOAD_MB must be positive")
+
+	check(c.Database.URL != "", "DATABASE_URL is required")
+	check(c.Storage.ConnectionString != "", "AZURE_STORAGE_CONNECTION_STRING is required")
+	check(c.Storage.AccountName != "", "AZURE_STORAGE_ACCOUNT_NAME must not be empty")
+	check(c.Storage.Container != "", "AZURE_STORAGE_CONTAINER_NAME must not be empty")
+	check(c.Queue.URL != "", "RABBITMQ_URL is required")
+	check(c.Queue.Name != "", "GOREEL_QUEUE_NAME must not be empty")
+	check(c.Queue.Prefetch > 0, "GOREEL_QUEUE_PREFETCH must be positive")
+	check(c.Worker.Port > 0 && c.Worker.Port < 65536, "GOREEL_WORKER_PORT must be between 1 and 65535")
+	check(c.Worker.ShutdownTimeout > 0, "GOREEL_WORKER_SHUTDOWN_TIMEOUT must be positive")
+	check(c.Video.TempDir != "", "GOREEL_TEMP_DIR must not be empty")
+
+	oidc := []string{c.Auth.OIDCIssuerURL, c.Auth.OIDCClientID, c.Auth.OIDCClientSecret.Value(), c.Auth.OIDCRedirectURL}
+	set := 0
+	for _, value := range oidc {
+		if value != "" {
+			set++
+		}
+	}
+	check(set == 0 || set == len(oidc), "OIDC_ISSUER_URL, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET and OIDC_REDIRECT_URL must be set together")
+	check(c.Auth.JWTSecret == "" || len(c.Auth.JWTSecret) >= 32, "GOREEL_JWT_SECRET must be at least 32 bytes long")
+	check(c.Auth.URLSigningSecret == "" || len(c.Auth.URLSigningSecret) >= 32, "GOREEL_URL_SIGNING_SECRET must be at least 32 bytes long")
+
+	check(c.Stats.ViewDedupWindow > 0, "GOREEL_VIEW_DEDUP_WINDOW must be positive")
+	check(c.Stats.FlushInterval > 0, "GOREEL_STATS_FLUSH_INTERVAL must be positive")
+
+	check(c.Log.Format == "json" || c.Log.Format == "text", "GOREEL_LOG_FORMAT must be json or text")
+	check(len(c.Log.Sinks) > 0, "GOREEL_LOG_SINKS must name at least one sink")
+	for _, sink := range c.Log.Sinks {
+		switch sink {
+		case logging.SinkStdout:
+		case logging.SinkFile:
+			check(c.Log.File != "", "GOREEL_LOG_FILE must be set to use the file sink")
+		case logging.SinkAxiom:
+			check(c.Log.AxiomToken != "" && c.Log.AxiomDataset != "", "AXIOM_TOKEN and AXIOM_DATASET must be set to use the axiom sink")
+		default:
+			check(false, "GOREEL_LOG_SINKS: unknown sink %q, expected stdout, file or axiom", sink)
+		}
+	}
+	check(c.Log.FileMaxBytes > 0, "GOREEL_LOG_FILE_MAX_MB must be positive")
+	check(c.Log.FileMaxBackups >= 0, "GOREEL_LOG_FILE_MAX_BACKUPS must not be negative")
+
+	return errors.Join(errs...)
+}
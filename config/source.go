@@ -0,0 +1,210 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dantdj/goreel/logging"
+)
+
+// Looks up raw setting values, collecting any that can't be parsed. Settings
+// that can't be parsed take their default, so validation only reports the
+// parse error for them.
+type source struct {
+	flags map[string]string
+	file  map[string]string
+	errs  []error
+}
+
+// Returns the value of a setting from the flags, the environment or the
+// config file, in that order.
+func (s *source) lookup(key string) (string, bool) {
+	if value, ok := s.flags[flagName(key)]; ok {
+		return value, true
+	}
+	if value := os.Getenv(key); value != "" {
+		return value, true
+	}
+	value, ok := s.file[key]
+	return value, ok
+}
+
+func (s *source) fail(key, format string, args ...any) {
+	s.errs = append(s.errs, fmt.Errorf("%s %s", key, fmt.Sprintf(format, args...)))
+}
+
+func (s *source) string(key, fallback string) string {
+	if value, ok := s.lookup(key); ok {
+		return value
+	}
+	return fallback
+}
+
+func (s *source) secret(key string) Secret {
+	return Secret(s.string(key, ""))
+}
+
+func (s *source) bool(key string) bool {
+	value, ok := s.lookup(key)
+	if !ok {
+		return false
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		s.fail(key, "must be true or false, got %q", value)
+		return false
+	}
+	return b
+}
+
+func (s *source) int(key string, fallback int) int {
+	value, ok := s.lookup(key)
+	if !ok {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		s.fail(key, "must be a whole number, got %q", value)
+		return fallback
+	}
+	return n
+}
+
+func (s *source) duration(key string, fallback time.Duration) time.Duration {
+	value, ok := s.lookup(key)
+	if !ok {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		s.fail(key, "must be a duration such as 30s or 5m, got %q", value)
+		return fallback
+	}
+	return d
+}
+
+func (s *source) level(key string, fallback slog.Level) slog.Level {
+	value, ok := s.lookup(key)
+	if !ok {
+		return fallback
+	}
+	level, err := logging.ParseLevel(value)
+	if err != nil {
+		s.fail(key, "must be debug, info, warn or error, got %q", value)
+		return fallback
+	}
+	return level
+}
+
+// Parses comma-separated package=level pairs.
+func (s *source) packageLevels(key string) map[string]slog.Level {
+	levels := map[string]slog.Level{}
+	value, ok := s.lookup(key)
+	if !ok || value == "" {
+		return levels
+	}
+
+	for pair := range strings.SplitSeq(value, ",") {
+		pkg, name, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || pkg == "" {
+			s.fail(key, "entry %q must be a package=level pair", pair)
+			continue
+		}
+		level, err := logging.ParseLevel(name)
+		if err != nil {
+			s.fail(key, "level for package %s must be debug, info, warn or error, got %q", pkg, name)
+			continue
+		}
+		levels[pkg] = level
+	}
+	return levels
+}
+
+func (s *source) list(key, fallback string) []string {
+	var values []string
+	for value := range strings.SplitSeq(s.string(key, fallback), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Builds the config from the settings, filling in defaults for any not given.
+func (s *source) parse() *Config {
+	local := s.bool("GOREEL_LOCAL")
+
+	// Production logs go to Axiom by default, and local ones to the terminal
+	defaultSinks := logging.SinkAxiom
+	if local {
+		defaultSinks = logging.SinkStdout
+	}
+
+	return &Config{
+		Local: local,
+		HTTP: HTTPConfig{
+			Port:            s.int("GOREEL_HTTP_PORT", 8089),
+			ReadTimeout:     s.duration("GOREEL_HTTP_READ_TIMEOUT", 10*time.Second),
+			WriteTimeout:    s.duration("GOREEL_HTTP_WRITE_TIMEOUT", 30*time.Second),
+			IdleTimeout:     s.duration("GOREEL_HTTP_IDLE_TIMEOUT", time.Minute),
+			ShutdownTimeout: s.duration("GOREEL_SHUTDOWN_TIMEOUT", 5*time.Second),
+			MaxUploadBytes:  int64(s.int("GOREEL_MAX_UPLOAD_MB", 500)) * 1024 * 1024,
+		},
+		Database: DatabaseConfig{
+			URL: s.secret("DATABASE_URL"),
+		},
+		Storage: StorageConfig{
+			ConnectionString: s.secret("AZURE_STORAGE_CONNECTION_STRING"),
+			AccountName:      s.string("AZURE_STORAGE_ACCOUNT_NAME", "goreelstorage"),
+			Container:        s.string("AZURE_STORAGE_CONTAINER_NAME", "videos"),
+		},
+		Queue: QueueConfig{
+			URL:      s.secret("RABBITMQ_URL"),
+			Name:     s.string("GOREEL_QUEUE_NAME", "video_jobs"),
+			Prefetch: s.int("GOREEL_QUEUE_PREFETCH", 1),
+		},
+		Worker: WorkerConfig{
+			Port:            s.int("GOREEL_WORKER_PORT", 8090),
+			ShutdownTimeout: s.duration("GOREEL_WORKER_SHUTDOWN_TIMEOUT", 5*time.Minute),
+		},
+		Video: VideoConfig{
+			ProfilesFile: s.string("GOREEL_PROFILES_FILE", ""),
+			TempDir:      s.string("GOREEL_TEMP_DIR", os.TempDir()),
+		},
+		Auth: AuthConfig{
+			OIDCIssuerURL:    s.string("OIDC_ISSUER_URL", ""),
+			OIDCClientID:     s.string("OIDC_CLIENT_ID", ""),
+			OIDCClientSecret: s.secret("OIDC_CLIENT_SECRET"),
+			OIDCRedirectURL:  s.string("OIDC_REDIRECT_URL", ""),
+			JWTSecret:        s.secret("GOREEL_JWT_SECRET"),
+			URLSigningSecret: s.secret("GOREEL_URL_SIGNING_SECRET"),
+		},
+		Moderation: ModerationConfig{
+			BannedWordsFile: s.string("GOREEL_BANNED_WORDS_FILE", ""),
+		},
+		Stats: StatsConfig{
+			ViewDedupWindow: s.duration("GOREEL_VIEW_DEDUP_WINDOW", 30*time.Minute),
+			FlushInterval:   s.duration("GOREEL_STATS_FLUSH_INTERVAL", 10*time.Second),
+		},
+		Log: LogConfig{
+			Level:          s.level("GOREEL_LOG_LEVEL", slog.LevelInfo),
+			PackageLevels:  s.packageLevels("GOREEL_LOG_PACKAGE_LEVELS"),
+			Format:         s.string("GOREEL_LOG_FORMAT", "json"),
+			Sinks:          s.list("GOREEL_LOG_SINKS", defaultSinks),
+			File:           s.string("GOREEL_LOG_FILE", "goreel.log"),
+			FileMaxBytes:   int64(s.int("GOREEL_LOG_FILE_MAX_MB", 100)) * 1024 * 1024,
+			FileMaxBackups: s.int("GOREEL_LOG_FILE_MAX_BACKUPS", 5),
+			AxiomToken:     s.secret("AXIOM_TOKEN"),
+			AxiomOrgID:     s.string("AXIOM_ORG_ID", ""),
+			AxiomDataset:   s.string("AXIOM_DATASET", ""),
+		},
+		Tracing: TracingConfig{
+			// Read straight from the environment, as that's where the exporter looks
+			Enabled: os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "",
+		},
+	}
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// An API key used by scripts and services to call the API. The key itself is
+// only shown when it's issued; just its hash is stored.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+const apiKeyColumns = `id, name, prefix, scopes, created_at, last_used_at, revoked_at`
+
+func scanAPIKey(row pgx.Row) (*APIKey, error) {
+	var k APIKey
+	if err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.Scopes, &k.CreatedAt, &k.LastUsedAt, &k.RevokedAt); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// Stores a newly issued API key by its hash.
+func (db *DB) CreateAPIKey(ctx context.Context, name, prefix string, hash []byte, scopes []string) (*APIKey, error) {
+	k, err := scanAPIKey(db.pool.QueryRow(ctx,
+		`INSERT INTO api_keys (name, prefix, key_hash, scopes) VALUES ($1, $2, $3, $4) RETURNING `+apiKeyColumns,
+		name, prefix, hash, scopes))
+	if err != nil {
+		return nil, fmt.Errorf("error creating API key %s: %w", name, err)
+	}
+	return k, nil
+}
+
+// Lists all API keys, including revoked ones, newest first.
+func (db *DB) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := db.pool.Query(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning API key: %w", err)
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+// Gets the active API key with the given hash, and notes that it's been used.
+// Unknown and revoked keys are reported as not found.
+func (db *DB) GetAPIKeyByHash(ctx context.Context, hash []byte) (*APIKey, error) {
+	k, err := scanAPIKey(db.pool.QueryRow(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL`, hash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting API key: %w", err)
+	}
+
+	// Only record use about once a minute, so busy keys don't write on every request
+	if k.LastUsedAt == nil || time.Since(*k.LastUsedAt) > time.Minute {
+		if _, err := db.pool.Exec(ctx, `UPDATE api_keys SET last_used_at = now() WHERE id = $1`, k.ID); err != nil {
+			return nil, fmt.Errorf("error recording use of API key %d: %w", k.ID, err)
+		}
+	}
+	return k, nil
+}
+
+// Revokes an API key so it can no longer be used. Revoking a key that's
+// already revoked succeeds.
+func (db *DB) RevokeAPIKey(ctx context.Context, id int64) error {
+	tag, err := db.pool.Exec(ctx,
+		`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("error revoking API key %d: %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// A subtitle or caption track attached to a video, one per language.
+type Caption struct {
+	VideoID   string    `json:"video_id"`
+	Language  string    `json:"language"`
+	Label     string    `json:"label"`
+	IsDefault bool      `json:"is_default"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Creates or replaces the caption track for the caption's video and language.
+// If the caption is marked as default, any other default track on the video is cleared.
+func (db *DB) UpsertCaption(ctx context.Context, c *Caption) error {
+	return pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		if c.IsDefault {
+			_, err := tx.Exec(ctx,
+				`UPDATE captions SET is_default = false, updated_at = now()
+				 WHERE video_id = $1 AND language <> $2 AND is_default`, c.VideoID, c.Language)
+			if err != nil {
+				return fmt.Errorf("error clearing default caption for video %s: %w", c.VideoID, err)
+			}
+		}
+
+		err := tx.QueryRow(ctx,
+			`INSERT INTO captions (video_id, language, label, is_default)
+			 VALUES ($1, $2, $3, $4)
+			 ON CONFLICT (video_id, language)
+			 DO UPDATE SET label = EXCLUDED.label, is_default = EXCLUDED.is_default, updated_at = now()
+			 RETURNING created_at, updated_at`,
+			c.VideoID, c.Language, c.Label, c.IsDefault).Scan(&c.CreatedAt, &c.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("error saving caption %s for video %s: %w", c.Language, c.VideoID, err)
+		}
+		return nil
+	})
+}
+
+func (db *DB) GetCaption(ctx context.Context, videoId, language string) (*Caption, error) {
+	var c Caption
+	err := db.pool.QueryRow(ctx,
+		`SELECT video_id, language, label, is_default, created_at, updated_at
+		 FROM captions WHERE video_id = $1 AND language = $2`, videoId, language).
+		Scan(&c.VideoID, &c.Language, &c.Label, &c.IsDefault, &c.CreatedAt, &c.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting caption %s for video %s: %w", language, videoId, err)
+	}
+	return &c, nil
+}
+
+func (db *DB) ListCaptions(ctx context.Context, videoId string) ([]Caption, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT video_id, language, label, is_default, created_at, updated_at
+		 FROM captions WHERE video_id = $1 ORDER BY language`, videoId)
+	if err != nil {
+		return nil, fmt.Errorf("error listing captions for video %s: %w", videoId, err)
+	}
+	defer rows.Close()
+
+	captions := []Caption{}
+	for rows.Next() {
+		var c Caption
+		if err := rows.Scan(&c.VideoID, &c.Language, &c.Label, &c.IsDefault, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning caption: %w", err)
+		}
+		captions = append(captions, c)
+	}
+	return captions, rows.Err()
+}
+
+func (db *DB) DeleteCaption(ctx context.Context, videoId, language string) error {
+	tag, err := db.pool.Exec(ctx, `DELETE FROM captions WHERE video_id = $1 AND language = $2`, videoId, language)
+	if err != nil {
+		return fmt.Errorf("error deleting caption %s for video %s: %w", language, videoId, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
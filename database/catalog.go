@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor can't be decoded, or
+// was issued for a different sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Sort orders supported when listing videos. A leading "-" sorts descending.
+var VideoSortSafelist = []string{
+	"created_at", "-created_at",
+	"duration", "-duration",
+	"popularity", "-popularity",
+}
+
+// The SQL expression each sort key orders by, along with the type its cursor value is cast to.
+var videoSortColumns = map[string]struct{ expr, cast string }{
+	"created_at": {"created_at", "timestamptz"},
+	"duration":   {"COALESCE(duration_seconds, 0)", "double precision"},
+	"popularity": {"view_count", "bigint"},
+}
+
+// VideoFilter narrows down and orders a listing of the video catalog.
+type VideoFilter struct {
+	Status        string
+	Visibility    string
+	OwnerID       string
+	Tag           string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// One of VideoSortSafelist
+	Sort string
+	// Opaque cursor from a previous page, or empty for the first page
+	Cursor string
+	Limit  int
+}
+
+// Position of the last row on a page. Value is the sort column's value as text,
+// so it can be cast back to the column's type in the query.
+type videoCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+func (c videoCursor) encode() string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeVideoCursor(s string) (videoCursor, error) {
+	var c videoCursor
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(js, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Lists videos matching the filter using keyset pagination. Returns the page of
+// videos and the cursor for the next page, which is empty if this is the last page.
+func (db *DB) ListVideos(ctx context.Context, f VideoFilter) ([]Video, string, error) {
+	key := strings.TrimPrefix(f.Sort, "-")
+	column, ok := videoSortColumns[key]
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported sort %q", f.Sort)
+	}
+	direction, comparison := "ASC", ">"
+	if strings.HasPrefix(f.Sort, "-") {
+		direction, comparison = "DESC", "<"
+	}
+
+	// Videos being deleted are never listed
+	conditions := []string{"status <> 'deleting'"}
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.Status != "" {
+		conditions = append(conditions, "status = "+arg(f.Status))
+	}
+	if f.Visibility != "" {
+		conditions = append(conditions, "visibility = "+arg(f.Visibility))
+	}
+	if f.OwnerID != "" {
+		conditions = append(conditions, "owner_id = "+arg(f.OwnerID))
+	}
+	if f.Tag != "" {
+		conditions = append(conditions, "tags @> ARRAY["+arg(f.Tag)+"]::text[]")
+	}
+	if f.CreatedAfter != nil {
+		conditions = append(conditions, "created_at >= "+arg(*f.CreatedAfter))
+	}
+	if f.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < "+arg(*f.CreatedBefore))
+	}
+	if f.Cursor != "" {
+		c, err := decodeVideoCursor(f.Cursor)
+		if err != nil || c.Sort != f.Sort {
+			return nil, "", ErrInvalidCursor
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s::%s, %s)",
+			column.expr, comparison, arg(c.Value), column.cast, arg(c.ID)))
+	}
+
+	query := `SELECT ` + videoColumns + `, (` + column.expr + `)::text FROM videos WHERE ` + strings.Join(conditions, " AND ")
+	// Fetch one extra row to find out whether there's another page
+	query += fmt.Sprintf(` ORDER BY %s %s, id %s LIMIT %s`, column.expr, direction, direction, arg(f.Limit+1))
+
+	rows, err := db.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("error listing videos: %w", err)
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	var sortValues []string
+	for rows.Next() {
+		var sortValue string
+		v, err := scanVideo(rows, &sortValue)
+		if err != nil {
+			return nil, "", fmt.Errorf("error scanning video: %w", err)
+		}
+		videos = append(videos, *v)
+		sortValues = append(sortValues, sortValue)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("error listing videos: %w", err)
+	}
+
+	if len(videos) <= f.Limit {
+		return videos, "", nil
+	}
+
+	videos = videos[:f.Limit]
+	last := videos[len(videos)-1]
+	next := videoCursor{Sort: f.Sort, Value: sortValues[f.Limit-1], ID: last.ID}
+	return videos, next.encode(), nil
+}
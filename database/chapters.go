@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// A navigation marker within a video.
+type Chapter struct {
+	ID        int64     `json:"id"`
+	VideoID   string    `json:"video_id"`
+	Start     float64   `json:"start"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const chapterColumns = `id, video_id, start_seconds, title, created_at, updated_at`
+
+func scanChapter(row pgx.Row) (*Chapter, error) {
+	var c Chapter
+	if err := row.Scan(&c.ID, &c.VideoID, &c.Start, &c.Title, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Lists a video's chapters in playback order.
+func (db *DB) ListChapters(ctx context.Context, videoId string) ([]Chapter, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT `+chapterColumns+` FROM chapters WHERE video_id = $1 ORDER BY start_seconds`, videoId)
+	if err != nil {
+		return nil, fmt.Errorf("error listing chapters for video %s: %w", videoId, err)
+	}
+	defer rows.Close()
+
+	chapters := []Chapter{}
+	for rows.Next() {
+		c, err := scanChapter(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning chapter: %w", err)
+		}
+		chapters = append(chapters, *c)
+	}
+	return chapters, rows.Err()
+}
+
+// Replaces all of a video's chapters with the given ones.
+func (db *DB) ReplaceChapters(ctx context.Context, videoId string, chapters []Chapter) error {
+	return pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		return replaceChapters(ctx, tx, videoId, chapters)
+	})
+}
+
+// Stores detected chapters, unless the video already has some. This keeps any
+// edits made to the chapters if the video is processed again.
+func (db *DB) CreateChaptersIfNone(ctx context.Context, videoId string, chapters []Chapter) error {
+	return pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		// Lock the video row so concurrent runs can't both insert
+		if _, err := tx.Exec(ctx, `SELECT 1 FROM videos WHERE id = $1 FOR UPDATE`, videoId); err != nil {
+			return fmt.Errorf("error locking video %s: %w", videoId, err)
+		}
+
+		var exists bool
+		err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM chapters WHERE video_id = $1)`, videoId).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("error checking chapters for video %s: %w", videoId, err)
+		}
+		if exists {
+			return nil
+		}
+
+		return replaceChapters(ctx, tx, videoId, chapters)
+	})
+}
+
+func replaceChapters(ctx context.Context, tx pgx.Tx, videoId string, chapters []Chapter) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM chapters WHERE video_id = $1`, videoId); err != nil {
+		return fmt.Errorf("error clearing chapters for video %s: %w", videoId, err)
+	}
+	for _, c := range chapters {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO chapters (video_id, start_seconds, title) VALUES ($1, $2, $3)`,
+			videoId, c.Start, c.Title)
+		if err != nil {
+			return fmt.Errorf("error inserting chapter for video %s: %w", videoId, err)
+		}
+	}
+	return nil
+}
+
+// Updates a single chapter's start time and title.
+func (db *DB) UpdateChapter(ctx context.Context, c *Chapter) error {
+	updated, err := scanChapter(db.pool.QueryRow(ctx,
+		`UPDATE chapters SET start_seconds = $3, title = $4, updated_at = now()
+		 WHERE id = $1 AND video_id = $2
+		 RETURNING `+chapterColumns,
+		c.ID, c.VideoID, c.Start, c.Title))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("error updating chapter %d: %w", c.ID, err)
+	}
+	*c = *updated
+	return nil
+}
+
+func (db *DB) GetChapter(ctx context.Context, videoId string, id int64) (*Chapter, error) {
+	c, err := scanChapter(db.pool.QueryRow(ctx,
+		`SELECT `+chapterColumns+` FROM chapters WHERE id = $1 AND video_id = $2`, id, videoId))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting chapter %d: %w", id, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,242 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Moderation states for a comment.
+const (
+	// Shown to everyone
+	CommentStatusVisible = "visible"
+	// Waiting for review, and only shown to its author and moderators
+	CommentStatusHeld = "held"
+	// Taken down by its author or a moderator. It stays in place, without its
+	// body, so replies to it keep their thread.
+	CommentStatusRemoved = "removed"
+)
+
+type Comment struct {
+	ID       int64  `json:"id"`
+	VideoID  string `json:"video_id"`
+	ParentID *int64 `json:"parent_id,omitempty"`
+	UserID   int64  `json:"user_id"`
+	// Name of the author, as given by their login provider
+	AuthorName string `json:"author_name"`
+	Body       string `json:"body"`
+	Status     string `json:"status"`
+	// Number of visible replies directly to this comment
+	ReplyCount int64     `json:"reply_count"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// CommentFilter selects a page of comments.
+type CommentFilter struct {
+	VideoID string
+	// List replies to this comment, or top-level comments if nil
+	ParentID *int64
+	// Held comments by this user are included, so authors can see their own
+	ViewerID *int64
+	// Include every held comment, for moderators
+	IncludeHeld bool
+	// List only comments in this state, across all videos, ignoring VideoID and
+	// ParentID. Used for the moderation queue.
+	Status string
+	// List newest first rather than oldest first
+	NewestFirst bool
+	// Opaque cursor from a previous page, or empty for the first page
+	Cursor string
+	Limit  int
+}
+
+const commentColumns = `comments.id, comments.video_id, comments.parent_id, comments.user_id,
+	COALESCE((SELECT name FROM users WHERE users.id = comments.user_id), ''),
+	comments.body, comments.status,
+	(SELECT count(*) FROM comments replies WHERE replies.parent_id = comments.id AND replies.status = 'visible'),
+	comments.created_at, comments.updated_at`
+
+func scanComment(row pgx.Row) (*Comment, error) {
+	var c Comment
+	err := row.Scan(&c.ID, &c.VideoID, &c.ParentID, &c.UserID, &c.AuthorName,
+		&c.Body, &c.Status, &c.ReplyCount, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Position of the last comment on a page.
+type commentCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int64     `json:"id"`
+}
+
+func (c commentCursor) encode() string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCommentCursor(s string) (commentCursor, error) {
+	var c commentCursor
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(js, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Inserts a new comment. Replies must be to a comment on the same video that
+// hasn't been removed, otherwise ErrNotFound is returned.
+func (db *DB) CreateComment(ctx context.Context, c *Comment) error {
+	created, err := scanComment(db.pool.QueryRow(ctx,
+		`INSERT INTO comments (video_id, parent_id, user_id, body, status)
+		 SELECT $1, $2, $3, $4, $5
+		 WHERE $2::bigint IS NULL OR EXISTS (
+		     SELECT 1 FROM comments WHERE id = $2 AND video_id = $1 AND status <> 'removed'
+		 )
+		 RETURNING `+commentColumns,
+		c.VideoID, c.ParentID, c.UserID, c.Body, c.Status))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error creating comment on video %s: %w", c.VideoID, err)
+	}
+	*c = *created
+	return nil
+}
+
+// Gets a comment on a video by ID.
+func (db *DB) GetComment(ctx context.Context, videoId string, id int64) (*Comment, error) {
+	c, err := scanComment(db.pool.QueryRow(ctx,
+		`SELECT `+commentColumns+` FROM comments WHERE id = $1 AND video_id = $2`, id, videoId))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting comment %d: %w", id, err)
+	}
+	return c, nil
+}
+
+// Updates a comment's body and moderation state. Removed comments can't be
+// changed, and are reported as not found.
+func (db *DB) UpdateComment(ctx context.Context, c *Comment) error {
+	updated, err := scanComment(db.pool.QueryRow(ctx,
+		`UPDATE comments SET body = $3, status = $4, updated_at = now()
+		 WHERE id = $1 AND video_id = $2 AND status <> 'removed'
+		 RETURNING `+commentColumns,
+		c.ID, c.VideoID, c.Body, c.Status))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error updating comment %d: %w", c.ID, err)
+	}
+	*c = *updated
+	return nil
+}
+
+// Moves a comment to a new moderation state. Removing a comment also clears
+// its body, so it can't be restored.
+func (db *DB) SetCommentStatus(ctx context.Context, id int64, status string) (*Comment, error) {
+	c, err := scanComment(db.pool.QueryRow(ctx,
+		`UPDATE comments SET status = $2, updated_at = now(),
+		     body = CASE WHEN $2 = 'removed' THEN '' ELSE body END
+		 WHERE id = $1 AND status <> 'removed'
+		 RETURNING `+commentColumns,
+		id, status))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error updating status of comment %d: %w", id, err)
+	}
+	return c, nil
+}
+
+// Lists comments matching the filter using keyset pagination. Returns the page
+// of comments and the cursor for the next page, which is empty if this is the
+// last page.
+func (db *DB) ListComments(ctx context.Context, f CommentFilter) ([]Comment, string, error) {
+	var conditions []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.Status != "" {
+		conditions = append(conditions, "comments.status = "+arg(f.Status))
+	} else {
+		conditions = append(conditions, "comments.video_id = "+arg(f.VideoID))
+		if f.ParentID != nil {
+			conditions = append(conditions, "comments.parent_id = "+arg(*f.ParentID))
+		} else {
+			conditions = append(conditions, "comments.parent_id IS NULL")
+		}
+
+		switch {
+		case f.IncludeHeld:
+		case f.ViewerID != nil:
+			conditions = append(conditions, "(comments.status <> 'held' OR comments.user_id = "+arg(*f.ViewerID)+")")
+		default:
+			conditions = append(conditions, "comments.status <> 'held'")
+		}
+	}
+
+	direction, comparison := "ASC", ">"
+	if f.NewestFirst {
+		direction, comparison = "DESC", "<"
+	}
+	if f.Cursor != "" {
+		c, err := decodeCommentCursor(f.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		conditions = append(conditions, fmt.Sprintf("(comments.created_at, comments.id) %s (%s, %s)",
+			comparison, arg(c.CreatedAt), arg(c.ID)))
+	}
+
+	// Fetch one extra row to find out whether there's another page
+	query := `SELECT ` + commentColumns + ` FROM comments WHERE ` + strings.Join(conditions, " AND ") +
+		fmt.Sprintf(` ORDER BY comments.created_at %s, comments.id %s LIMIT %s`, direction, direction, arg(f.Limit+1))
+
+	rows, err := db.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("error listing comments: %w", err)
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("error scanning comment: %w", err)
+		}
+		comments = append(comments, *c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("error listing comments: %w", err)
+	}
+
+	if len(comments) <= f.Limit {
+		return comments, "", nil
+	}
+
+	comments = comments[:f.Limit]
+	last := comments[len(comments)-1]
+	next := commentCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	return comments, next.encode(), nil
+}
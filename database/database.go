@@ -1 +1,115 @@
 package database
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// ErrNotFound is returned when a requested record doesn't exist.
+var ErrNotFound = errors.New("record not found")
+
+// ErrConflict is returned when a write would break a uniqueness constraint.
+var ErrConflict = errors.New("record conflicts with an existing one")
+
+// DB wraps a Postgres connection pool and exposes the queries used by the application.
+type DB struct {
+	pool *pgxpool.Pool
+}
+
+// Opens a connection pool to the Postgres database at the given URL
+// and verifies that it can be reached.
+func Open(ctx context.Context, url string) (*DB, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("error creating database pool: %w", err)
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("error connecting to database: %w", err)
+	}
+
+	return &DB{pool: pool}, nil
+}
+
+// Wraps an existing connection pool, without checking that it can be reached.
+func New(pool *pgxpool.Pool) *DB {
+	return &DB{pool: pool}
+}
+
+func (db *DB) Close() {
+	db.pool.Close()
+}
+
+// Checks that the database can be reached.
+func (db *DB) Ping(ctx context.Context) error {
+	return db.pool.Ping(ctx)
+}
+
+// Applies any embedded migrations that haven't been run yet, in filename order.
+func (db *DB) Migrate(ctx context.Context) error {
+	_, err := db.pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		name       TEXT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("error creating migrations table: %w", err)
+	}
+
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return fmt.Errorf("error listing migrations: %w", err)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version := strings.TrimPrefix(name, "migrations/")
+
+		var exists bool
+		err := db.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE name = $1)`, version).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("error checking migration %s: %w", version, err)
+		}
+		if exists {
+			continue
+		}
+
+		sql, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("error reading migration %s: %w", version, err)
+		}
+
+		err = pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, string(sql)); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, `INSERT INTO schema_migrations (name) VALUES ($1)`, version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("error applying migration %s: %w", version, err)
+		}
+
+		slog.Info("Applied database migration", slog.String("migration", version))
+	}
+
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,27 @@
+CREATE TABLE videos (
+    id         TEXT PRIMARY KEY,
+    status     TEXT NOT NULL DEFAULT 'uploaded',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE renditions (
+    video_id  TEXT NOT NULL REFERENCES videos (id) ON DELETE CASCADE,
+    name      TEXT NOT NULL,
+    playlist  TEXT NOT NULL,
+    bandwidth INTEGER NOT NULL,
+    width     INTEGER NOT NULL,
+    height    INTEGER NOT NULL,
+    codecs    TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (video_id, name)
+);
+
+CREATE TABLE captions (
+    video_id   TEXT NOT NULL REFERENCES videos (id) ON DELETE CASCADE,
+    language   TEXT NOT NULL,
+    label      TEXT NOT NULL,
+    is_default BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (video_id, language)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE videos
+    ADD COLUMN profile             TEXT NOT NULL DEFAULT 'default',
+    ADD COLUMN loudness_integrated DOUBLE PRECISION,
+    ADD COLUMN loudness_true_peak  DOUBLE PRECISION;
@@ -0,0 +1,3 @@
+ALTER TABLE renditions ADD COLUMN kind TEXT NOT NULL DEFAULT 'video';
+
+ALTER TABLE videos ADD COLUMN audio_download TEXT;
@@ -0,0 +1,6 @@
+ALTER TABLE videos
+    ADD COLUMN source_video_id    TEXT REFERENCES videos (id) ON DELETE SET NULL,
+    ADD COLUMN clip_start_seconds DOUBLE PRECISION,
+    ADD COLUMN clip_end_seconds   DOUBLE PRECISION;
+
+CREATE INDEX videos_source_video_id_idx ON videos (source_video_id);
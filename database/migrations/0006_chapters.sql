@@ -0,0 +1,11 @@
+ALTER TABLE videos ADD COLUMN duration_seconds DOUBLE PRECISION;
+
+CREATE TABLE chapters (
+    id            BIGSERIAL PRIMARY KEY,
+    video_id      TEXT NOT NULL REFERENCES videos (id) ON DELETE CASCADE,
+    start_seconds DOUBLE PRECISION NOT NULL,
+    title         TEXT NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (video_id, start_seconds)
+);
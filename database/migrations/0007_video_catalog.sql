@@ -0,0 +1,10 @@
+ALTER TABLE videos
+    ADD COLUMN owner_id   TEXT,
+    ADD COLUMN tags       TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN view_count BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX videos_created_at_idx ON videos (created_at, id);
+CREATE INDEX videos_duration_idx ON videos ((COALESCE(duration_seconds, 0)), id);
+CREATE INDEX videos_view_count_idx ON videos (view_count, id);
+CREATE INDEX videos_owner_id_idx ON videos (owner_id);
+CREATE INDEX videos_tags_idx ON videos USING GIN (tags);
@@ -0,0 +1,6 @@
+ALTER TABLE videos
+    ADD COLUMN title       TEXT NOT NULL DEFAULT '',
+    ADD COLUMN description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN visibility  TEXT NOT NULL DEFAULT 'public';
+
+CREATE INDEX videos_status_idx ON videos (status);
@@ -0,0 +1,18 @@
+CREATE TABLE favourites (
+    user_id    BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    video_id   TEXT NOT NULL REFERENCES videos (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, video_id)
+);
+
+CREATE TABLE likes (
+    user_id    BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    video_id   TEXT NOT NULL REFERENCES videos (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, video_id)
+);
+
+CREATE INDEX likes_video_id_idx ON likes (video_id);
+
+-- Kept in step with the likes table, so it can be shown without counting
+ALTER TABLE videos ADD COLUMN like_count BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,20 @@
+ALTER TABLE videos ADD COLUMN watch_seconds DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+-- When each viewer's view of a video was last counted, so repeat views within
+-- the dedup window aren't counted again
+CREATE TABLE video_viewers (
+    video_id   TEXT NOT NULL REFERENCES videos (id) ON DELETE CASCADE,
+    viewer     TEXT NOT NULL,
+    counted_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (video_id, viewer)
+);
+
+CREATE INDEX video_viewers_counted_at_idx ON video_viewers (counted_at);
+
+CREATE TABLE video_daily_stats (
+    video_id      TEXT NOT NULL REFERENCES videos (id) ON DELETE CASCADE,
+    day           DATE NOT NULL,
+    views         BIGINT NOT NULL DEFAULT 0,
+    watch_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    PRIMARY KEY (video_id, day)
+);
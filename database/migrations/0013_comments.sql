@@ -0,0 +1,15 @@
+CREATE TABLE comments (
+    id         BIGSERIAL PRIMARY KEY,
+    video_id   TEXT NOT NULL REFERENCES videos (id) ON DELETE CASCADE,
+    -- The comment this is a reply to, or NULL for a top-level comment
+    parent_id  BIGINT REFERENCES comments (id) ON DELETE CASCADE,
+    user_id    BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    body       TEXT NOT NULL,
+    status     TEXT NOT NULL DEFAULT 'visible',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX comments_thread_idx ON comments (video_id, parent_id, created_at, id);
+CREATE INDEX comments_parent_id_idx ON comments (parent_id);
+CREATE INDEX comments_status_idx ON comments (status, created_at, id);
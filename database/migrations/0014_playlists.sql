@@ -0,0 +1,23 @@
+CREATE TABLE playlists (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    title       TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    visibility  TEXT NOT NULL DEFAULT 'private',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX playlists_user_id_idx ON playlists (user_id, id);
+
+-- Items are numbered from 0 in play order, and renumbered whenever the order changes
+CREATE TABLE playlist_items (
+    playlist_id BIGINT NOT NULL REFERENCES playlists (id) ON DELETE CASCADE,
+    video_id    TEXT NOT NULL REFERENCES videos (id) ON DELETE CASCADE,
+    position    INTEGER NOT NULL,
+    added_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (playlist_id, video_id)
+);
+
+CREATE INDEX playlist_items_position_idx ON playlist_items (playlist_id, position);
+CREATE INDEX playlist_items_video_id_idx ON playlist_items (video_id);
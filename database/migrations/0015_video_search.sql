@@ -0,0 +1,25 @@
+ALTER TABLE videos ADD COLUMN search_vector tsvector;
+
+-- Titles rank above tags, which rank above descriptions. Tags aren't stemmed,
+-- so searching for a tag matches it exactly.
+CREATE FUNCTION videos_search_vector(title TEXT, description TEXT, tags TEXT[]) RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+           setweight(to_tsvector('simple', array_to_string(tags, ' ')), 'B') ||
+           setweight(to_tsvector('english', coalesce(description, '')), 'C')
+$$ LANGUAGE SQL STABLE;
+
+-- Keeps the search vector in step with the metadata it's built from
+CREATE FUNCTION videos_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := videos_search_vector(NEW.title, NEW.description, NEW.tags);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER videos_search_vector_update
+    BEFORE INSERT OR UPDATE OF title, description, tags ON videos
+    FOR EACH ROW EXECUTE FUNCTION videos_search_vector_update();
+
+UPDATE videos SET search_vector = videos_search_vector(title, description, tags);
+
+CREATE INDEX videos_search_idx ON videos USING GIN (search_vector);
@@ -0,0 +1,9 @@
+-- Tags are stemmed along with titles and descriptions, so one English query
+-- matches the whole vector and keeps its exclusions and phrases intact.
+CREATE OR REPLACE FUNCTION videos_search_vector(title TEXT, description TEXT, tags TEXT[]) RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+           setweight(to_tsvector('english', array_to_string(tags, ' ')), 'B') ||
+           setweight(to_tsvector('english', coalesce(description, '')), 'C')
+$$ LANGUAGE SQL STABLE;
+
+UPDATE videos SET search_vector = videos_search_vector(title, description, tags);
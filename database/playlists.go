@@ -0,0 +1,382 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// The most videos a playlist can hold.
+const MaxPlaylistItems = 1000
+
+// ErrPlaylistFull is returned when adding to a playlist that already holds
+// MaxPlaylistItems videos.
+var ErrPlaylistFull = errors.New("playlist is full")
+
+// Reasons a video in a playlist can't be played.
+const (
+	UnavailableProcessing = "processing"
+	UnavailableFailed     = "failed"
+	UnavailablePrivate    = "private"
+)
+
+// An ordered collection of videos put together by a user.
+type Playlist struct {
+	ID          int64  `json:"id"`
+	UserID      int64  `json:"user_id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Either public or private; playlists can't be unlisted
+	Visibility string    `json:"visibility"`
+	ItemCount  int64     `json:"item_count"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// A video's place in a playlist. Videos that can't currently be played, such
+// as ones still processing, keep their place but are skipped over by the
+// previous and next links used for continuous play.
+type PlaylistItem struct {
+	Position  int       `json:"position"`
+	VideoID   string    `json:"video_id"`
+	AddedAt   time.Time `json:"added_at"`
+	Available bool      `json:"available"`
+	// Why the video can't be played, if it can't
+	UnavailableReason string `json:"unavailable_reason,omitempty"`
+	// The video's details, only included if it's available
+	Video *Video `json:"video,omitempty"`
+	// The nearest playable videos before and after this one
+	PreviousVideoID *string `json:"previous_video_id,omitempty"`
+	NextVideoID     *string `json:"next_video_id,omitempty"`
+}
+
+// PlaylistItemFilter selects a page of a playlist's items.
+type PlaylistItemFilter struct {
+	PlaylistID int64
+	// Private videos owned by this owner ID are playable
+	ViewerOwnerID *string
+	// Every private video is playable, for admins
+	IncludePrivate bool
+	// Opaque cursor from a previous page, or empty for the first page
+	Cursor string
+	Limit  int
+}
+
+const playlistColumns = `playlists.id, playlists.user_id, playlists.title, playlists.description, playlists.visibility,
+	(SELECT count(*) FROM playlist_items i INNER JOIN videos v ON v.id = i.video_id
+	 WHERE i.playlist_id = playlists.id AND v.status <> 'deleting'),
+	playlists.created_at, playlists.updated_at`
+
+func scanPlaylist(row pgx.Row) (*Playlist, error) {
+	var p Playlist
+	err := row.Scan(&p.ID, &p.UserID, &p.Title, &p.Description, &p.Visibility, &p.ItemCount, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Pages are keyed on a single integer: a playlist ID, or an item position.
+type positionCursor struct {
+	After int64 `json:"after"`
+}
+
+func (c positionCursor) encode() string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodePositionCursor(s string) (positionCursor, error) {
+	var c positionCursor
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(js, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Inserts a new, empty playlist.
+func (db *DB) CreatePlaylist(ctx context.Context, p *Playlist) error {
+	created, err := scanPlaylist(db.pool.QueryRow(ctx,
+		`INSERT INTO playlists (user_id, title, description, visibility) VALUES ($1, $2, $3, $4)
+		 RETURNING `+playlistColumns,
+		p.UserID, p.Title, p.Description, p.Visibility))
+	if err != nil {
+		return fmt.Errorf("error creating playlist for user %d: %w", p.UserID, err)
+	}
+	*p = *created
+	return nil
+}
+
+// Gets a playlist by ID.
+func (db *DB) GetPlaylist(ctx context.Context, id int64) (*Playlist, error) {
+	p, err := scanPlaylist(db.pool.QueryRow(ctx, `SELECT `+playlistColumns+` FROM playlists WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting playlist %d: %w", id, err)
+	}
+	return p, nil
+}
+
+// Updates a playlist's title, description and visibility.
+func (db *DB) UpdatePlaylist(ctx context.Context, p *Playlist) error {
+	updated, err := scanPlaylist(db.pool.QueryRow(ctx,
+		`UPDATE playlists SET title = $2, description = $3, visibility = $4, updated_at = now()
+		 WHERE id = $1
+		 RETURNING `+playlistColumns,
+		p.ID, p.Title, p.Description, p.Visibility))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error updating playlist %d: %w", p.ID, err)
+	}
+	*p = *updated
+	return nil
+}
+
+// Removes a playlist. The videos in it are untouched.
+func (db *DB) DeletePlaylist(ctx context.Context, id int64) error {
+	tag, err := db.pool.Exec(ctx, `DELETE FROM playlists WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("error deleting playlist %d: %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Lists a user's playlists, newest first, optionally only their public ones.
+// Returns the page of playlists and the cursor for the next page, which is
+// empty if this is the last page.
+func (db *DB) ListPlaylists(ctx context.Context, userId int64, publicOnly bool, cursor string, limit int) ([]Playlist, string, error) {
+	before := int64(1<<63 - 1)
+	if cursor != "" {
+		c, err := decodePositionCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		before = c.After
+	}
+
+	// Fetch one extra row to find out whether there's another page
+	rows, err := db.pool.Query(ctx,
+		`SELECT `+playlistColumns+` FROM playlists
+		 WHERE user_id = $1 AND id < $2 AND (NOT $3 OR visibility = 'public')
+		 ORDER BY id DESC LIMIT $4`,
+		userId, before, publicOnly, limit+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("error listing playlists for user %d: %w", userId, err)
+	}
+	defer rows.Close()
+
+	playlists := []Playlist{}
+	for rows.Next() {
+		p, err := scanPlaylist(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("error scanning playlist: %w", err)
+		}
+		playlists = append(playlists, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("error listing playlists for user %d: %w", userId, err)
+	}
+
+	if len(playlists) <= limit {
+		return playlists, "", nil
+	}
+	playlists = playlists[:limit]
+	return playlists, positionCursor{After: playlists[limit-1].ID}.encode(), nil
+}
+
+// Adds a video to a playlist at the given position, or at the end if position
+// is nil or past the end. Returns ErrConflict if the video is already in the
+// playlist, and ErrNotFound if the video doesn't exist.
+func (db *DB) AddPlaylistItem(ctx context.Context, playlistId int64, videoId string, position *int) error {
+	return db.reorderPlaylist(ctx, playlistId, func(order []string) ([]string, error) {
+		if slices.Contains(order, videoId) {
+			return nil, ErrConflict
+		}
+		if len(order) >= MaxPlaylistItems {
+			return nil, ErrPlaylistFull
+		}
+
+		at := len(order)
+		if position != nil && *position < at {
+			at = max(*position, 0)
+		}
+		return slices.Insert(order, at, videoId), nil
+	}, videoId)
+}
+
+// Removes a video from a playlist, closing up the gap it leaves.
+func (db *DB) RemovePlaylistItem(ctx context.Context, playlistId int64, videoId string) error {
+	return db.reorderPlaylist(ctx, playlistId, func(order []string) ([]string, error) {
+		i := slices.Index(order, videoId)
+		if i < 0 {
+			return nil, ErrNotFound
+		}
+		return slices.Delete(order, i, i+1), nil
+	}, "")
+}
+
+// Moves a video to a new position in a playlist, shifting the videos between
+// its old and new positions along by one. Positions past the end move the
+// video to the end.
+func (db *DB) MovePlaylistItem(ctx context.Context, playlistId int64, videoId string, position int) error {
+	return db.reorderPlaylist(ctx, playlistId, func(order []string) ([]string, error) {
+		i := slices.Index(order, videoId)
+		if i < 0 {
+			return nil, ErrNotFound
+		}
+		order = slices.Delete(order, i, i+1)
+		return slices.Insert(order, min(max(position, 0), len(order)), videoId), nil
+	}, "")
+}
+
+// Rewrites a playlist's items in the order returned by change, which is given
+// the current order. The playlist is locked while this happens, so concurrent
+// changes are applied one after another. A non-empty added video is inserted
+// as a new item.
+func (db *DB) reorderPlaylist(ctx context.Context, playlistId int64, change func([]string) ([]string, error), added string) error {
+	return pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `SELECT 1 FROM playlists WHERE id = $1 FOR UPDATE`, playlistId)
+		if err != nil {
+			return fmt.Errorf("error locking playlist %d: %w", playlistId, err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+
+		rows, err := tx.Query(ctx,
+			`SELECT video_id FROM playlist_items WHERE playlist_id = $1 ORDER BY position`, playlistId)
+		if err != nil {
+			return fmt.Errorf("error listing items in playlist %d: %w", playlistId, err)
+		}
+		order, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return fmt.Errorf("error listing items in playlist %d: %w", playlistId, err)
+		}
+
+		order, err = change(order)
+		if err != nil {
+			return err
+		}
+
+		if added != "" {
+			var exists bool
+			err := tx.QueryRow(ctx,
+				`SELECT EXISTS (SELECT 1 FROM videos WHERE id = $1 AND status <> 'deleting')`, added).Scan(&exists)
+			if err != nil {
+				return fmt.Errorf("error checking video %s: %w", added, err)
+			}
+			if !exists {
+				return ErrNotFound
+			}
+			_, err = tx.Exec(ctx,
+				`INSERT INTO playlist_items (playlist_id, video_id, position) VALUES ($1, $2, -1)`, playlistId, added)
+			if err != nil {
+				return fmt.Errorf("error adding video %s to playlist %d: %w", added, playlistId, err)
+			}
+		}
+
+		_, err = tx.Exec(ctx,
+			`DELETE FROM playlist_items WHERE playlist_id = $1 AND NOT (video_id = ANY($2))`, playlistId, order)
+		if err != nil {
+			return fmt.Errorf("error removing items from playlist %d: %w", playlistId, err)
+		}
+		_, err = tx.Exec(ctx,
+			`UPDATE playlist_items SET position = o.position - 1
+			 FROM unnest($2::text[]) WITH ORDINALITY AS o(video_id, position)
+			 WHERE playlist_items.playlist_id = $1 AND playlist_items.video_id = o.video_id`,
+			playlistId, order)
+		if err != nil {
+			return fmt.Errorf("error renumbering playlist %d: %w", playlistId, err)
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE playlists SET updated_at = now() WHERE id = $1`, playlistId)
+		if err != nil {
+			return fmt.Errorf("error updating playlist %d: %w", playlistId, err)
+		}
+		return nil
+	})
+}
+
+// Lists a page of a playlist's items in play order, along with the nearest
+// playable videos either side of each for continuous play. Videos being
+// deleted are left out. Returns the page of items and the cursor for the next
+// page, which is empty if this is the last page.
+func (db *DB) ListPlaylistItems(ctx context.Context, f PlaylistItemFilter) ([]PlaylistItem, string, error) {
+	after := int64(-1)
+	if f.Cursor != "" {
+		c, err := decodePositionCursor(f.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		after = c.After
+	}
+
+	// Fetch one extra row to find out whether there's another page
+	rows, err := db.pool.Query(ctx,
+		`WITH items AS (
+		     SELECT i.position, i.added_at, v.*,
+		         CASE
+		             WHEN v.status = 'failed' THEN 'failed'
+		             WHEN v.status <> 'ready' THEN 'processing'
+		             WHEN v.visibility = 'private' AND NOT $2 AND v.owner_id IS DISTINCT FROM $3 THEN 'private'
+		             ELSE ''
+		         END AS unavailable_reason
+		     FROM playlist_items i INNER JOIN videos v ON v.id = i.video_id
+		     WHERE i.playlist_id = $1 AND v.status <> 'deleting'
+		 )
+		 SELECT `+videoColumns+`, position, added_at, unavailable_reason,
+		     (SELECT p.id FROM items p WHERE p.unavailable_reason = '' AND p.position < items.position
+		      ORDER BY p.position DESC LIMIT 1),
+		     (SELECT n.id FROM items n WHERE n.unavailable_reason = '' AND n.position > items.position
+		      ORDER BY n.position LIMIT 1)
+		 FROM items
+		 WHERE position > $4
+		 ORDER BY position LIMIT $5`,
+		f.PlaylistID, f.IncludePrivate, f.ViewerOwnerID, after, f.Limit+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("error listing items in playlist %d: %w", f.PlaylistID, err)
+	}
+	defer rows.Close()
+
+	items := []PlaylistItem{}
+	for rows.Next() {
+		var item PlaylistItem
+		v, err := scanVideo(rows, &item.Position, &item.AddedAt, &item.UnavailableReason,
+			&item.PreviousVideoID, &item.NextVideoID)
+		if err != nil {
+			return nil, "", fmt.Errorf("error scanning playlist item: %w", err)
+		}
+		item.VideoID = v.ID
+		item.Available = item.UnavailableReason == ""
+		if item.Available {
+			item.Video = v
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("error listing items in playlist %d: %w", f.PlaylistID, err)
+	}
+
+	if len(items) <= f.Limit {
+		return items, "", nil
+	}
+	items = items[:f.Limit]
+	return items, positionCursor{After: int64(items[f.Limit-1].Position)}.encode(), nil
+}
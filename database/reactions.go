@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Adds a video to a user's favourites. Favouriting a video twice has no
+// further effect.
+func (db *DB) AddFavourite(ctx context.Context, userId int64, videoId string) error {
+	_, err := db.pool.Exec(ctx,
+		`INSERT INTO favourites (user_id, video_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, userId, videoId)
+	if err != nil {
+		return fmt.Errorf("error favouriting video %s for user %d: %w", videoId, userId, err)
+	}
+	return nil
+}
+
+// Removes a video from a user's favourites, if it was there.
+func (db *DB) RemoveFavourite(ctx context.Context, userId int64, videoId string) error {
+	_, err := db.pool.Exec(ctx, `DELETE FROM favourites WHERE user_id = $1 AND video_id = $2`, userId, videoId)
+	if err != nil {
+		return fmt.Errorf("error unfavouriting video %s for user %d: %w", videoId, userId, err)
+	}
+	return nil
+}
+
+// Lists the videos a user has favourited, most recently favourited first.
+// Videos being deleted are left out.
+func (db *DB) ListFavourites(ctx context.Context, userId int64) ([]Video, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT `+videoColumns+` FROM videos
+		 INNER JOIN (SELECT video_id, created_at AS favourited_at FROM favourites WHERE user_id = $1) f
+		 ON f.video_id = videos.id
+		 WHERE status <> 'deleting'
+		 ORDER BY f.favourited_at DESC, videos.id`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error listing favourites for user %d: %w", userId, err)
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		v, err := scanVideo(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning video: %w", err)
+		}
+		videos = append(videos, *v)
+	}
+	return videos, rows.Err()
+}
+
+// Records a user's like of a video and returns the video's like count. The
+// count only changes if the like is new, and is updated in the same
+// transaction, so concurrent and repeated likes can't skew it.
+func (db *DB) AddLike(ctx context.Context, userId int64, videoId string) (int64, error) {
+	return db.changeLike(ctx, videoId,
+		`INSERT INTO likes (user_id, video_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, userId, 1)
+}
+
+// Removes a user's like of a video, if there was one, and returns the video's
+// like count.
+func (db *DB) RemoveLike(ctx context.Context, userId int64, videoId string) (int64, error) {
+	return db.changeLike(ctx, videoId,
+		`DELETE FROM likes WHERE user_id = $1 AND video_id = $2`, userId, -1)
+}
+
+func (db *DB) changeLike(ctx context.Context, videoId, query string, userId int64, delta int) (int64, error) {
+	var count int64
+	err := pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, query, userId, videoId)
+		if err != nil {
+			return fmt.Errorf("error changing like of video %s for user %d: %w", videoId, userId, err)
+		}
+		if tag.RowsAffected() == 0 {
+			delta = 0
+		}
+
+		// The row lock taken by the update serialises concurrent changes to the count
+		err = tx.QueryRow(ctx,
+			`UPDATE videos SET like_count = like_count + $2 WHERE id = $1 RETURNING like_count`,
+			videoId, delta).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("error updating like count for video %s: %w", videoId, err)
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Reports whether a user has liked and favourited a video.
+func (db *DB) GetReactions(ctx context.Context, userId int64, videoId string) (liked, favourited bool, err error) {
+	err = db.pool.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM likes WHERE user_id = $1 AND video_id = $2),
+		        EXISTS (SELECT 1 FROM favourites WHERE user_id = $1 AND video_id = $2)`,
+		userId, videoId).Scan(&liked, &favourited)
+	if err != nil {
+		return false, false, fmt.Errorf("error getting reactions to video %s for user %d: %w", videoId, userId, err)
+	}
+	return liked, favourited, nil
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The search terms as a text search query, stemmed the same way as every part
+// of the search vector.
+const searchQuery = "websearch_to_tsquery('english', $1)"
+
+// SearchFilter describes a full-text search of the public video catalog.
+type SearchFilter struct {
+	// Search terms, in web search syntax: quoted phrases, "or" and "-" to exclude
+	Query string
+	// Only match videos with all of these tags
+	Tags           []string
+	MinDuration    *float64
+	MaxDuration    *float64
+	UploadedAfter  *time.Time
+	UploadedBefore *time.Time
+	// Page number, counting from 1
+	Page  int
+	Limit int
+}
+
+// The number of search results with a given tag.
+type TagFacet struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+// Builds the WHERE clause shared by searches and their facets. Only public,
+// ready videos are searched.
+func (f SearchFilter) where() (string, []any) {
+	args := []any{f.Query}
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions := []string{
+		"search_vector @@ " + searchQuery,
+		"status = 'ready'",
+		"visibility = 'public'",
+	}
+	if len(f.Tags) > 0 {
+		conditions = append(conditions, "tags @> "+arg(f.Tags)+"::text[]")
+	}
+	if f.MinDuration != nil {
+		conditions = append(conditions, "duration_seconds >= "+arg(*f.MinDuration))
+	}
+	if f.MaxDuration != nil {
+		conditions = append(conditions, "duration_seconds <= "+arg(*f.MaxDuration))
+	}
+	if f.UploadedAfter != nil {
+		conditions = append(conditions, "created_at >= "+arg(*f.UploadedAfter))
+	}
+	if f.UploadedBefore != nil {
+		conditions = append(conditions, "created_at < "+arg(*f.UploadedBefore))
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// Searches video titles, descriptions and tags, best matches first. Returns a
+// page of matching videos and the total number of matches.
+func (db *DB) SearchVideos(ctx context.Context, f SearchFilter) ([]Video, int64, error) {
+	where, args := f.where()
+	args = append(args, f.Limit, (f.Page-1)*f.Limit)
+
+	rows, err := db.pool.Query(ctx,
+		`SELECT `+videoColumns+`, count(*) OVER () FROM videos WHERE `+where+
+			fmt.Sprintf(` ORDER BY ts_rank_cd(search_vector, `+searchQuery+`) DESC, created_at DESC, id
+			 LIMIT $%d OFFSET $%d`, len(args)-1, len(args)),
+		args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error searching videos: %w", err)
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	var total int64
+	for rows.Next() {
+		v, err := scanVideo(rows, &total)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error scanning video: %w", err)
+		}
+		videos = append(videos, *v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error searching videos: %w", err)
+	}
+	return videos, total, nil
+}
+
+// Counts the most common tags across all matches for a search, most common
+// first, up to the limit.
+func (db *DB) SearchTagFacets(ctx context.Context, f SearchFilter, limit int) ([]TagFacet, error) {
+	where, args := f.where()
+	args = append(args, limit)
+
+	rows, err := db.pool.Query(ctx,
+		`SELECT tag, count(*) FROM videos, unnest(tags) AS tag WHERE `+where+
+			fmt.Sprintf(` GROUP BY tag ORDER BY count(*) DESC, tag LIMIT $%d`, len(args)),
+		args...)
+	if err != nil {
+		return nil, fmt.Errorf("error counting search tags: %w", err)
+	}
+	defer rows.Close()
+
+	facets := []TagFacet{}
+	for rows.Next() {
+		var facet TagFacet
+		if err := rows.Scan(&facet.Tag, &facet.Count); err != nil {
+			return nil, fmt.Errorf("error scanning tag facet: %w", err)
+		}
+		facets = append(facets, facet)
+	}
+	return facets, rows.Err()
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+// Opens the database named by GOREEL_TEST_DATABASE_URL, skipping the test if it isn't set.
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	url := os.Getenv("GOREEL_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("GOREEL_TEST_DATABASE_URL not set")
+	}
+
+	db, err := Open(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	if err := db.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSearchFilter_Where(t *testing.T) {
+	minDuration := 60.0
+	f := SearchFilter{Query: "dinner -cooking", Tags: []string{"food"}, MinDuration: &minDuration}
+
+	where, args := f.where()
+	expected := "search_vector @@ websearch_to_tsquery('english', $1) AND status = 'ready' AND visibility = 'public'" +
+		" AND tags @> $2::text[] AND duration_seconds >= $3"
+	if where != expected {
+		t.Errorf("expected %q, got %q", expected, where)
+	}
+	if len(args) != 3 || args[0] != f.Query || args[2] != minDuration {
+		t.Errorf("unexpected args %v", args)
+	}
+}
+
+func TestSearchVideos_Tags(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	id := "search-test-tag"
+	if err := db.CreateVideo(ctx, id, "default", nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.DeleteVideo(context.Background(), id) })
+
+	// "cooking" stems to "cook", which has to match however the tag is searched for
+	v := &Video{ID: id, Title: "Dinner", Tags: []string{"cooking"}, Visibility: VisibilityPublic}
+	if err := db.UpdateVideoMetadata(ctx, v); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetVideoStatus(ctx, id, VideoStatusReady); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"cooking":         true,
+		"cook":            true,
+		"dinner cooking":  true,
+		"dinner baking":   false,
+		"dinner -cooking": false,
+	}
+	for query, expected := range tests {
+		videos, _, err := db.SearchVideos(ctx, SearchFilter{Query: query, Page: 1, Limit: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, v := range videos {
+			found = found || v.ID == id
+		}
+		if found != expected {
+			t.Errorf("%q: expected found to be %t, got %t", query, expected, found)
+		}
+	}
+}
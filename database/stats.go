@@ -0,0 +1,157 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// A viewer starting playback of a video.
+type ViewEvent struct {
+	VideoID string
+	// Opaque key identifying the viewer, used to deduplicate their views
+	Viewer string
+	At     time.Time
+}
+
+// Time spent watching a video on a given day, summed across viewers.
+type WatchTime struct {
+	VideoID string
+	Day     time.Time
+	Seconds float64
+}
+
+// A video's views and watch time for a single day.
+type DailyStats struct {
+	Day          string  `json:"day"`
+	Views        int64   `json:"views"`
+	WatchSeconds float64 `json:"watch_seconds"`
+}
+
+// Applies a batch of views and watch time to the per-video totals and daily
+// rollups, in a single transaction. A view is only counted if the same viewer
+// hasn't had a view of the video counted within the dedup window. Events for
+// videos that have since been deleted are dropped.
+func (db *DB) RecordVideoStats(ctx context.Context, views []ViewEvent, watch []WatchTime, window time.Duration) error {
+	type dayKey struct {
+		videoId string
+		day     time.Time
+	}
+	type dayTotals struct {
+		views   int64
+		seconds float64
+	}
+
+	// Rows are always locked in the same order, so concurrent flushes can't deadlock
+	views = slices.Clone(views)
+	slices.SortFunc(views, func(a, b ViewEvent) int {
+		return cmp.Or(cmp.Compare(a.VideoID, b.VideoID), cmp.Compare(a.Viewer, b.Viewer))
+	})
+
+	err := pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		totals := map[dayKey]*dayTotals{}
+		add := func(videoId string, day time.Time) *dayTotals {
+			key := dayKey{videoId, statsDay(day)}
+			if totals[key] == nil {
+				totals[key] = &dayTotals{}
+			}
+			return totals[key]
+		}
+
+		for _, v := range views {
+			// Only claims the viewer's slot if their last counted view is outside the window
+			tag, err := tx.Exec(ctx,
+				`INSERT INTO video_viewers (video_id, viewer, counted_at)
+				 SELECT id, $2, $3 FROM videos WHERE id = $1
+				 ON CONFLICT (video_id, viewer) DO UPDATE SET counted_at = EXCLUDED.counted_at
+				 WHERE video_viewers.counted_at <= $4`,
+				v.VideoID, v.Viewer, v.At, v.At.Add(-window))
+			if err != nil {
+				return fmt.Errorf("error recording viewer of video %s: %w", v.VideoID, err)
+			}
+			if tag.RowsAffected() > 0 {
+				add(v.VideoID, v.At).views++
+			}
+		}
+		for _, w := range watch {
+			add(w.VideoID, w.Day).seconds += w.Seconds
+		}
+
+		keys := slices.SortedFunc(maps.Keys(totals), func(a, b dayKey) int {
+			return cmp.Or(cmp.Compare(a.videoId, b.videoId), a.day.Compare(b.day))
+		})
+		for _, key := range keys {
+			t := totals[key]
+			if err := addDailyStats(ctx, tx, key.videoId, key.day, t.views, t.seconds); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Viewers outside the window would be counted again anyway, so they can go.
+	// This runs outside the transaction to avoid holding their locks while it does.
+	_, err = db.pool.Exec(ctx, `DELETE FROM video_viewers WHERE counted_at < $1`, time.Now().Add(-window))
+	if err != nil {
+		return fmt.Errorf("error clearing expired viewers: %w", err)
+	}
+	return nil
+}
+
+func addDailyStats(ctx context.Context, tx pgx.Tx, videoId string, day time.Time, views int64, seconds float64) error {
+	tag, err := tx.Exec(ctx,
+		`UPDATE videos SET view_count = view_count + $2, watch_seconds = watch_seconds + $3 WHERE id = $1`,
+		videoId, views, seconds)
+	if err != nil {
+		return fmt.Errorf("error updating stats for video %s: %w", videoId, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO video_daily_stats (video_id, day, views, watch_seconds) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (video_id, day) DO UPDATE SET
+		     views = video_daily_stats.views + EXCLUDED.views,
+		     watch_seconds = video_daily_stats.watch_seconds + EXCLUDED.watch_seconds`,
+		videoId, day, views, seconds)
+	if err != nil {
+		return fmt.Errorf("error updating daily stats for video %s: %w", videoId, err)
+	}
+	return nil
+}
+
+// Lists a video's daily stats from the given day onwards, oldest first. Days
+// without any activity are left out.
+func (db *DB) ListDailyStats(ctx context.Context, videoId string, since time.Time) ([]DailyStats, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT to_char(day, 'YYYY-MM-DD'), views, watch_seconds FROM video_daily_stats
+		 WHERE video_id = $1 AND day >= $2 ORDER BY day`, videoId, statsDay(since))
+	if err != nil {
+		return nil, fmt.Errorf("error listing daily stats for video %s: %w", videoId, err)
+	}
+	defer rows.Close()
+
+	stats := []DailyStats{}
+	for rows.Next() {
+		var s DailyStats
+		if err := rows.Scan(&s.Day, &s.Views, &s.WatchSeconds); err != nil {
+			return nil, fmt.Errorf("error scanning daily stats: %w", err)
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// Returns the UTC day a time falls on, as stats are rolled up by UTC day.
+func statsDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
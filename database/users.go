@@ -0,0 +1,177 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// How long a login attempt can take at the provider before it's rejected.
+const loginAttemptTTL = 10 * time.Minute
+
+// A user account. Users log in through one or more linked external identities.
+type User struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// A login that's been started at an OIDC provider, waiting for its callback.
+type LoginAttempt struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+	RedirectTo   string
+}
+
+const userColumns = `users.id, users.email, users.name, users.created_at, users.updated_at`
+
+func scanUser(row pgx.Row) (*User, error) {
+	var u User
+	if err := row.Scan(&u.ID, &u.Email, &u.Name, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Returns the ID to record as the owner of a user's videos.
+func (u *User) OwnerID() string {
+	return strconv.FormatInt(u.ID, 10)
+}
+
+// Gets a user by ID.
+func (db *DB) GetUser(ctx context.Context, id int64) (*User, error) {
+	u, err := scanUser(db.pool.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting user %d: %w", id, err)
+	}
+	return u, nil
+}
+
+// Finds the user linked to an external identity, creating both if this is the
+// identity's first login. The user's email and name are refreshed from the
+// provider's latest claims.
+func (db *DB) UpsertUserByIdentity(ctx context.Context, issuer, subject, email, name string) (*User, error) {
+	var user *User
+	err := pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		// Take a lock on the identity so concurrent first logins can't create two users
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1 || ' ' || $2))`, issuer, subject); err != nil {
+			return fmt.Errorf("error locking identity: %w", err)
+		}
+
+		var userId int64
+		err := tx.QueryRow(ctx,
+			`SELECT user_id FROM identities WHERE issuer = $1 AND subject = $2`, issuer, subject).Scan(&userId)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			if err := tx.QueryRow(ctx,
+				`INSERT INTO users (email, name) VALUES ($1, $2) RETURNING id`, email, name).Scan(&userId); err != nil {
+				return fmt.Errorf("error creating user: %w", err)
+			}
+			if _, err := tx.Exec(ctx,
+				`INSERT INTO identities (issuer, subject, user_id) VALUES ($1, $2, $3)`, issuer, subject, userId); err != nil {
+				return fmt.Errorf("error linking identity: %w", err)
+			}
+		case err != nil:
+			return fmt.Errorf("error finding identity: %w", err)
+		}
+
+		u, err := scanUser(tx.QueryRow(ctx,
+			`UPDATE users SET email = $2, name = $3, updated_at = now() WHERE id = $1 RETURNING `+userColumns,
+			userId, email, name))
+		if err != nil {
+			return fmt.Errorf("error updating user %d: %w", userId, err)
+		}
+		user = u
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Stores a new session for the user. Only a hash of the token is kept.
+func (db *DB) CreateSession(ctx context.Context, token string, userId int64, expiresAt time.Time) error {
+	hash := sha256.Sum256([]byte(token))
+	_, err := db.pool.Exec(ctx,
+		`INSERT INTO sessions (token_hash, user_id, expires_at) VALUES ($1, $2, $3)`, hash[:], userId, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error creating session for user %d: %w", userId, err)
+	}
+	return nil
+}
+
+// Gets the user that a session token belongs to. Unknown and expired sessions
+// are reported as not found.
+func (db *DB) GetUserForSession(ctx context.Context, token string) (*User, error) {
+	hash := sha256.Sum256([]byte(token))
+	u, err := scanUser(db.pool.QueryRow(ctx,
+		`SELECT `+userColumns+` FROM users
+		 INNER JOIN sessions ON sessions.user_id = users.id
+		 WHERE sessions.token_hash = $1 AND sessions.expires_at > now()`, hash[:]))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting user for session: %w", err)
+	}
+	return u, nil
+}
+
+// Removes a session, logging it out.
+func (db *DB) DeleteSession(ctx context.Context, token string) error {
+	hash := sha256.Sum256([]byte(token))
+	if _, err := db.pool.Exec(ctx, `DELETE FROM sessions WHERE token_hash = $1`, hash[:]); err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+	return nil
+}
+
+// Records a login that's been sent to the provider. Stale attempts are cleared
+// out at the same time.
+func (db *DB) CreateLoginAttempt(ctx context.Context, a *LoginAttempt) error {
+	if _, err := db.pool.Exec(ctx,
+		`DELETE FROM login_attempts WHERE created_at < $1`, time.Now().Add(-loginAttemptTTL)); err != nil {
+		return fmt.Errorf("error clearing stale login attempts: %w", err)
+	}
+	if _, err := db.pool.Exec(ctx,
+		`DELETE FROM sessions WHERE expires_at < now()`); err != nil {
+		return fmt.Errorf("error clearing expired sessions: %w", err)
+	}
+
+	_, err := db.pool.Exec(ctx,
+		`INSERT INTO login_attempts (state, nonce, code_verifier, redirect_to) VALUES ($1, $2, $3, $4)`,
+		a.State, a.Nonce, a.CodeVerifier, a.RedirectTo)
+	if err != nil {
+		return fmt.Errorf("error creating login attempt: %w", err)
+	}
+	return nil
+}
+
+// Removes and returns the login attempt with the given state, so each one can
+// only be completed once. Expired attempts are reported as not found.
+func (db *DB) ConsumeLoginAttempt(ctx context.Context, state string) (*LoginAttempt, error) {
+	var a LoginAttempt
+	err := db.pool.QueryRow(ctx,
+		`DELETE FROM login_attempts WHERE state = $1 AND created_at >= $2
+		 RETURNING state, nonce, code_verifier, redirect_to`,
+		state, time.Now().Add(-loginAttemptTTL)).Scan(&a.State, &a.Nonce, &a.CodeVerifier, &a.RedirectTo)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error consuming login attempt: %w", err)
+	}
+	return &a, nil
+}
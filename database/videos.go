@@ -0,0 +1,306 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Lifecycle states for a video.
+const (
+	VideoStatusUploaded   = "uploaded"
+	VideoStatusProcessing = "processing"
+	VideoStatusReady      = "ready"
+	VideoStatusFailed     = "failed"
+	// The video is being removed in the background, and is treated as gone
+	VideoStatusDeleting = "deleting"
+)
+
+// Who can see a video.
+const (
+	// Listed in the catalog for everyone
+	VisibilityPublic = "public"
+	// Viewable by anyone with the link, but not listed
+	VisibilityUnlisted = "unlisted"
+	// Only viewable by its owner
+	VisibilityPrivate = "private"
+)
+
+// Kinds of rendition a video can have.
+const (
+	RenditionKindVideo = "video"
+	RenditionKindAudio = "audio"
+)
+
+type Video struct {
+	ID          string   `json:"id"`
+	Status      string   `json:"status"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Visibility  string   `json:"visibility"`
+	Profile     string   `json:"profile"`
+	OwnerID     *string  `json:"owner_id,omitempty"`
+	Tags        []string `json:"tags"`
+	// Number of times the video has been watched, used to rank by popularity
+	ViewCount int64 `json:"view_count"`
+	LikeCount int64 `json:"like_count"`
+	// Total time spent watching the video, in seconds
+	WatchSeconds float64 `json:"watch_seconds"`
+	// Length of the source in seconds, once it has been processed
+	Duration *float64 `json:"duration,omitempty"`
+	// Loudness of the source audio as measured before normalization,
+	// in LUFS and dBTP. Nil if the video hasn't been normalized.
+	LoudnessIntegrated *float64 `json:"loudness_integrated,omitempty"`
+	LoudnessTruePeak   *float64 `json:"loudness_true_peak,omitempty"`
+	// Name of the standalone audio file, relative to the video, if one was produced
+	AudioDownload *string `json:"audio_download,omitempty"`
+	// Name of the animated preview, relative to the video, if one was produced
+	Preview *string `json:"preview,omitempty"`
+	// Set when the video was clipped from another, with the cut points in seconds
+	SourceVideoID *string   `json:"source_video_id,omitempty"`
+	ClipStart     *float64  `json:"clip_start,omitempty"`
+	ClipEnd       *float64  `json:"clip_end,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// A single HLS variant stream produced for a video.
+type Rendition struct {
+	VideoID   string `json:"-"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Playlist  string `json:"playlist"`
+	Bandwidth int    `json:"bandwidth"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Codecs    string `json:"codecs"`
+}
+
+// Inserts a new video record in the uploaded state, to be encoded with the named
+// profile. The owner is nil for anonymous uploads.
+func (db *DB) CreateVideo(ctx context.Context, id, profile string, ownerId *string) error {
+	_, err := db.pool.Exec(ctx, `INSERT INTO videos (id, status, profile, owner_id) VALUES ($1, $2, $3, $4)`,
+		id, VideoStatusUploaded, profile, ownerId)
+	if err != nil {
+		return fmt.Errorf("error creating video %s: %w", id, err)
+	}
+	return nil
+}
+
+// Columns selected for a video, in the order scanVideo expects.
+const videoColumns = `id, status, title, description, visibility, profile, owner_id, tags, view_count, like_count, watch_seconds, duration_seconds,
+	loudness_integrated, loudness_true_peak, audio_download, preview,
+	source_video_id, clip_start_seconds, clip_end_seconds, created_at, updated_at`
+
+// Scans a row selected with videoColumns, plus any extra columns selected after them.
+func scanVideo(row pgx.Row, extra ...any) (*Video, error) {
+	var v Video
+	dest := []any{
+		&v.ID, &v.Status, &v.Title, &v.Description, &v.Visibility, &v.Profile, &v.OwnerID, &v.Tags, &v.ViewCount, &v.LikeCount, &v.WatchSeconds, &v.Duration,
+		&v.LoudnessIntegrated, &v.LoudnessTruePeak, &v.AudioDownload, &v.Preview,
+		&v.SourceVideoID, &v.ClipStart, &v.ClipEnd, &v.CreatedAt, &v.UpdatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// Inserts a new video record for a clip of the source video, inheriting its
+// encoding profile. The clip starts in the uploaded state, as its media is
+// cut from the source in the background. The clip is owned by whoever created
+// it, rather than the owner of the source.
+func (db *DB) CreateClip(ctx context.Context, id, sourceId string, start, end float64, ownerId *string) (*Video, error) {
+	v, err := scanVideo(db.pool.QueryRow(ctx,
+		`INSERT INTO videos (id, status, profile, source_video_id, clip_start_seconds, clip_end_seconds, owner_id)
+		 SELECT $1, $2, profile, id, $4, $5, $6 FROM videos WHERE id = $3 AND status <> 'deleting'
+		 RETURNING `+videoColumns,
+		id, VideoStatusUploaded, sourceId, start, end, ownerId))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating clip %s of video %s: %w", id, sourceId, err)
+	}
+	return v, nil
+}
+
+// Gets a video by ID. Videos that are being deleted are reported as not found.
+func (db *DB) GetVideo(ctx context.Context, id string) (*Video, error) {
+	v, err := scanVideo(db.pool.QueryRow(ctx,
+		`SELECT `+videoColumns+` FROM videos WHERE id = $1 AND status <> 'deleting'`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting video %s: %w", id, err)
+	}
+	return v, nil
+}
+
+// Gets a video that has been flagged for deletion but not yet removed.
+func (db *DB) GetDeletingVideo(ctx context.Context, id string) (*Video, error) {
+	v, err := scanVideo(db.pool.QueryRow(ctx,
+		`SELECT `+videoColumns+` FROM videos WHERE id = $1 AND status = 'deleting'`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting video %s: %w", id, err)
+	}
+	return v, nil
+}
+
+// Moves a video to a new processing status. Videos being deleted are left alone,
+// so an in-flight job can't bring one back.
+func (db *DB) SetVideoStatus(ctx context.Context, id, status string) error {
+	tag, err := db.pool.Exec(ctx,
+		`UPDATE videos SET status = $2, updated_at = now() WHERE id = $1 AND status <> 'deleting'`, id, status)
+	if err != nil {
+		return fmt.Errorf("error updating status for video %s: %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Updates the user-editable details of a video.
+func (db *DB) UpdateVideoMetadata(ctx context.Context, v *Video) error {
+	updated, err := scanVideo(db.pool.QueryRow(ctx,
+		`UPDATE videos SET title = $2, description = $3, tags = $4, visibility = $5, updated_at = now()
+		 WHERE id = $1 AND status <> 'deleting'
+		 RETURNING `+videoColumns,
+		v.ID, v.Title, v.Description, v.Tags, v.Visibility))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error updating video %s: %w", v.ID, err)
+	}
+	*v = *updated
+	return nil
+}
+
+// Flags a video for deletion. Flagging a video that's already being deleted
+// succeeds, so deletes can safely be retried.
+func (db *DB) MarkVideoDeleting(ctx context.Context, id string) error {
+	tag, err := db.pool.Exec(ctx, `UPDATE videos SET status = $2, updated_at = now() WHERE id = $1`, id, VideoStatusDeleting)
+	if err != nil {
+		return fmt.Errorf("error marking video %s for deletion: %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Lists the IDs of videos flagged for deletion before the given time, so
+// unfinished deletes can be resumed.
+func (db *DB) ListDeletingVideoIDs(ctx context.Context, before time.Time) ([]string, error) {
+	rows, err := db.pool.Query(ctx, `SELECT id FROM videos WHERE status = $1 AND updated_at < $2`, VideoStatusDeleting, before)
+	if err != nil {
+		return nil, fmt.Errorf("error listing deleting videos: %w", err)
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// Removes a video's record along with its renditions, captions and chapters.
+// Removing a video that's already gone is not an error.
+func (db *DB) DeleteVideo(ctx context.Context, id string) error {
+	if _, err := db.pool.Exec(ctx, `DELETE FROM videos WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("error deleting video %s: %w", id, err)
+	}
+	return nil
+}
+
+func (db *DB) SetVideoDuration(ctx context.Context, id string, duration float64) error {
+	tag, err := db.pool.Exec(ctx, `UPDATE videos SET duration_seconds = $2, updated_at = now() WHERE id = $1`, id, duration)
+	if err != nil {
+		return fmt.Errorf("error updating duration for video %s: %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Records the source loudness measured during normalization.
+func (db *DB) SetVideoLoudness(ctx context.Context, id string, integrated, truePeak float64) error {
+	tag, err := db.pool.Exec(ctx,
+		`UPDATE videos SET loudness_integrated = $2, loudness_true_peak = $3, updated_at = now() WHERE id = $1`,
+		id, integrated, truePeak)
+	if err != nil {
+		return fmt.Errorf("error updating loudness for video %s: %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Records the name of the standalone audio file produced for the video.
+func (db *DB) SetVideoAudioDownload(ctx context.Context, id, name string) error {
+	tag, err := db.pool.Exec(ctx, `UPDATE videos SET audio_download = $2, updated_at = now() WHERE id = $1`, id, name)
+	if err != nil {
+		return fmt.Errorf("error updating audio download for video %s: %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Records the name of the animated preview produced for the video.
+func (db *DB) SetVideoPreview(ctx context.Context, id, name string) error {
+	tag, err := db.pool.Exec(ctx, `UPDATE videos SET preview = $2, updated_at = now() WHERE id = $1`, id, name)
+	if err != nil {
+		return fmt.Errorf("error updating preview for video %s: %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Replaces the set of renditions recorded for a video.
+func (db *DB) SetRenditions(ctx context.Context, videoId string, renditions []Rendition) error {
+	return pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM renditions WHERE video_id = $1`, videoId); err != nil {
+			return fmt.Errorf("error clearing renditions for video %s: %w", videoId, err)
+		}
+		for _, r := range renditions {
+			_, err := tx.Exec(ctx,
+				`INSERT INTO renditions (video_id, kind, name, playlist, bandwidth, width, height, codecs)
+				 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+				videoId, r.Kind, r.Name, r.Playlist, r.Bandwidth, r.Width, r.Height, r.Codecs)
+			if err != nil {
+				return fmt.Errorf("error inserting rendition %s for video %s: %w", r.Name, videoId, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (db *DB) ListRenditions(ctx context.Context, videoId string) ([]Rendition, error) {
+	rows, err := db.pool.Query(ctx,
+		`SELECT video_id, kind, name, playlist, bandwidth, width, height, codecs
+		 FROM renditions WHERE video_id = $1 ORDER BY bandwidth DESC`, videoId)
+	if err != nil {
+		return nil, fmt.Errorf("error listing renditions for video %s: %w", videoId, err)
+	}
+	defer rows.Close()
+
+	var renditions []Rendition
+	for rows.Next() {
+		var r Rendition
+		if err := rows.Scan(&r.VideoID, &r.Kind, &r.Name, &r.Playlist, &r.Bandwidth, &r.Width, &r.Height, &r.Codecs); err != nil {
+			return nil, fmt.Errorf("error scanning rendition: %w", err)
+		}
+		renditions = append(renditions, r)
+	}
+	return renditions, rows.Err()
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package health
+
+import "errors"
+
+// Returns the bytes free for unprivileged users on the filesystem holding path.
+// Only supported on Unix-like systems.
+func FreeSpace(path string) (uint64, error) {
+	return 0, errors.New("free space checks aren't supported on this platform")
+}
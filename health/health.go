@@ -0,0 +1,102 @@
+// Package health runs readiness checks against the service's dependencies and
+// reports how each of them is doing.
+package health
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Statuses reported for each check, and for the service overall.
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Check probes a single dependency. Run returns a short description of what it
+// found, such as a version, or an error if the dependency isn't usable.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) (string, error)
+}
+
+// Result is the outcome of a single check.
+type Result struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Detail    string  `json:"detail,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the outcome of a set of checks. The status is only ok if every
+// check passed.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Runs the checks at the same time, giving each up to timeout to finish.
+func Run(ctx context.Context, checks []Check, timeout time.Duration) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			detail, err := check.Run(checkCtx)
+			result := Result{
+				Status:    StatusOK,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+				Detail:    detail,
+			}
+			if err != nil {
+				slog.Warn("Readiness check failed", slog.String("check", check.Name), slog.String("error", err.Error()))
+				result.Status = StatusUnavailable
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = result
+			if err != nil {
+				report.Status = StatusUnavailable
+			}
+		}()
+	}
+	wg.Wait()
+
+	return report
+}
+
+// Wraps a check so it only runs once per ttl, reusing its last result in
+// between. Runs cut short by their context aren't reused.
+func Cached(check Check, ttl time.Duration) Check {
+	var mu sync.Mutex
+	var ranAt time.Time
+	var detail string
+	var err error
+
+	return Check{Name: check.Name, Run: func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !ranAt.IsZero() && time.Since(ranAt) < ttl {
+			return detail, err
+		}
+		detail, err = check.Run(ctx)
+		ranAt = time.Now()
+		if ctx.Err() != nil {
+			ranAt = time.Time{}
+		}
+		return detail, err
+	}}
+}
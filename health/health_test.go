@@ -0,0 +1,59 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	checks := []Check{
+		{Name: "up", Run: func(ctx context.Context) (string, error) { return "v1", nil }},
+		{Name: "down", Run: func(ctx context.Context) (string, error) { return "", errors.New("refused") }},
+		{Name: "slow", Run: func(ctx context.Context) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}},
+	}
+
+	report := Run(context.Background(), checks, 10*time.Millisecond)
+
+	if report.Status != StatusUnavailable {
+		t.Errorf("expected overall status %q, got %q", StatusUnavailable, report.Status)
+	}
+	if got := report.Checks["up"]; got.Status != StatusOK || got.Detail != "v1" {
+		t.Errorf("expected up to pass with its detail, got %+v", got)
+	}
+	if got := report.Checks["down"]; got.Status != StatusUnavailable || got.Error != "refused" {
+		t.Errorf("expected down to fail with its error, got %+v", got)
+	}
+	if got := report.Checks["slow"]; got.Status != StatusUnavailable {
+		t.Errorf("expected slow to time out, got %+v", got)
+	}
+}
+
+func TestRun_AllPassing(t *testing.T) {
+	checks := []Check{{Name: "up", Run: func(ctx context.Context) (string, error) { return "", nil }}}
+
+	if report := Run(context.Background(), checks, time.Second); report.Status != StatusOK {
+		t.Errorf("expected overall status %q, got %q", StatusOK, report.Status)
+	}
+}
+
+func TestCached(t *testing.T) {
+	runs := 0
+	check := Cached(Check{Name: "tool", Run: func(ctx context.Context) (string, error) {
+		runs++
+		return "v1", nil
+	}}, time.Minute)
+
+	for range 3 {
+		if detail, err := check.Run(context.Background()); detail != "v1" || err != nil {
+			t.Fatalf("expected the check's result, got %q, %v", detail, err)
+		}
+	}
+	if runs != 1 {
+		t.Errorf("expected the check to run once, ran %d times", runs)
+	}
+}
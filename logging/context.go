@@ -0,0 +1,47 @@
+// Package logging carries request-scoped loggers through contexts, so log lines
+// written while handling a request, or running the jobs it queued, can be tied
+// back to it.
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+type contextKey string
+
+const (
+	loggerContextKey    = contextKey("logger")
+	requestIDContextKey = contextKey("requestID")
+)
+
+// Returns a copy of ctx carrying the given logger.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey, logger)
+}
+
+// Returns the logger in ctx, or the default logger if there isn't one.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Returns a copy of ctx carrying the request ID, with its logger tagging every
+// line with the ID too.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDContextKey, id)
+	return NewContext(ctx, FromContext(ctx).With(slog.String("request_id", id)))
+}
+
+// Returns the request ID in ctx, or an empty string if there isn't one.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// Returns a copy of ctx whose logger tags every line with the given attributes.
+func With(ctx context.Context, attrs ...any) context.Context {
+	return NewContext(ctx, FromContext(ctx).With(attrs...))
+}
@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestPackageOf(t *testing.T) {
+	tests := map[string]string{
+		"github.com/dantdj/goreel/video.(*Processor).process": "video",
+		"github.com/dantdj/goreel/api.routes.func1":           "api",
+		"main.main": "main",
+		"github.com/rabbitmq/amqp091-go.(*Channel).Publish": "github.com/rabbitmq/amqp091-go",
+		"": "",
+	}
+	for function, expected := range tests {
+		if got := packageOf(function); got != expected {
+			t.Errorf("packageOf(%q): expected %q, got %q", function, expected, got)
+		}
+	}
+}
+
+func TestLevelHandler_PackageOverrides(t *testing.T) {
+	var buf bytes.Buffer
+	levels := NewLevels(slog.LevelWarn)
+	logger := slog.New(&levelHandler{
+		next:   slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		levels: levels,
+	})
+
+	logger.Info("hidden by default")
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing to be logged, got %q", buf.String())
+	}
+
+	// Records logged from this file belong to the logging package
+	levels.Set("logging", slog.LevelDebug)
+	logger.Debug("shown by override")
+	if !strings.Contains(buf.String(), "shown by override") {
+		t.Fatalf("expected the debug record to be logged, got %q", buf.String())
+	}
+
+	buf.Reset()
+	levels.Unset("logging")
+	logger.Info("hidden again")
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing to be logged after unsetting the override, got %q", buf.String())
+	}
+}
+
+func TestFanoutHandler_WritesToEverySink(t *testing.T) {
+	var first, second bytes.Buffer
+	logger := slog.New(&fanoutHandler{handlers: []slog.Handler{
+		slog.NewJSONHandler(&first, nil),
+		slog.NewTextHandler(&second, nil),
+	}}).With(slog.String("request_id", "abc"))
+
+	logger.Info("hello")
+
+	for name, buf := range map[string]*bytes.Buffer{"first": &first, "second": &second} {
+		if !strings.Contains(buf.String(), "hello") || !strings.Contains(buf.String(), "abc") {
+			t.Errorf("expected the %s sink to get the record, got %q", name, buf.String())
+		}
+	}
+}
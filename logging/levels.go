@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"log/slog"
+	"maps"
+	"sync"
+	"sync/atomic"
+)
+
+// Levels holds the minimum log level, overridable per package, and can be
+// changed while the service is running.
+type Levels struct {
+	mu       sync.RWMutex
+	fallback slog.Level
+	packages map[string]slog.Level
+	// Lowest level across the fallback and every override, so records below it
+	// can be dropped without working out which package they came from
+	lowest atomic.Int64
+}
+
+// Creates a Levels with the given default level and no package overrides.
+func NewLevels(fallback slog.Level) *Levels {
+	l := &Levels{fallback: fallback, packages: map[string]slog.Level{}}
+	l.lowest.Store(int64(fallback))
+	return l
+}
+
+// Returns the level used for packages without an override.
+func (l *Levels) Default() slog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.fallback
+}
+
+// Changes the level used for packages without an override.
+func (l *Levels) SetDefault(level slog.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fallback = level
+	l.updateLowest()
+}
+
+// Overrides the level for a package, named by its import path relative to the
+// module, such as "video", or its full import path for other modules.
+func (l *Levels) Set(pkg string, level slog.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.packages[pkg] = level
+	l.updateLowest()
+}
+
+// Removes a package's override, so it goes back to the default level.
+func (l *Levels) Unset(pkg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.packages, pkg)
+	l.updateLowest()
+}
+
+// Returns the level for the given package.
+func (l *Levels) For(pkg string) slog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if level, ok := l.packages[pkg]; ok {
+		return level
+	}
+	return l.fallback
+}
+
+// Returns a copy of the package overrides.
+func (l *Levels) Packages() map[string]slog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return maps.Clone(l.packages)
+}
+
+// Reports whether a record at the given level could be logged by any package.
+func (l *Levels) mayLog(level slog.Level) bool {
+	return level >= slog.Level(l.lowest.Load())
+}
+
+// Must be called with the lock held.
+func (l *Levels) updateLowest() {
+	lowest := l.fallback
+	for _, level := range l.packages {
+		lowest = min(lowest, level)
+	}
+	l.lowest.Store(int64(lowest))
+}
+
+// Parses a level name such as "debug" or "WARN". Offsets like "info+2" are
+// accepted too, as with slog.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
@@ -0,0 +1,137 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/axiomhq/axiom-go/axiom"
+
+	adapter "github.com/axiomhq/axiom-go/adapters/slog"
+)
+
+// Names of the sinks log records can be sent to.
+const (
+	SinkStdout = "stdout"
+	SinkFile   = "file"
+	SinkAxiom  = "axiom"
+)
+
+// Config describes where logs go and how much is logged.
+type Config struct {
+	Level slog.Level
+	// Per-package overrides of Level
+	PackageLevels map[string]slog.Level
+	// "json" or "text". Only applies to the stdout and file sinks, as Axiom
+	// takes structured events.
+	Format string
+	// Every record is written to all of these sinks
+	Sinks []string
+
+	File           string
+	FileMaxBytes   int64
+	FileMaxBackups int
+
+	AxiomToken   string
+	AxiomOrgID   string
+	AxiomDataset string
+}
+
+// Output is a logger writing to the configured sinks.
+type Output struct {
+	Logger *slog.Logger
+	// Changing these takes effect straight away
+	Levels  *Levels
+	closers []func() error
+}
+
+// Sets up a logger writing to every sink in the config.
+func Open(cfg Config) (*Output, error) {
+	out := &Output{Levels: NewLevels(cfg.Level)}
+	for pkg, level := range cfg.PackageLevels {
+		out.Levels.Set(pkg, level)
+	}
+
+	// Sinks accept everything, and the level handler in front decides what's logged
+	options := &slog.HandlerOptions{Level: slog.LevelDebug - 4}
+
+	var handlers []slog.Handler
+	for _, sink := range cfg.Sinks {
+		switch sink {
+		case SinkStdout:
+			handler, err := formatHandler(cfg.Format, os.Stdout, options)
+			if err != nil {
+				out.Close()
+				return nil, err
+			}
+			handlers = append(handlers, handler)
+
+		case SinkFile:
+			file, err := OpenRotatingFile(cfg.File, cfg.FileMaxBytes, cfg.FileMaxBackups)
+			if err != nil {
+				out.Close()
+				return nil, err
+			}
+			out.closers = append(out.closers, file.Close)
+
+			handler, err := formatHandler(cfg.Format, file, options)
+			if err != nil {
+				out.Close()
+				return nil, err
+			}
+			handlers = append(handlers, handler)
+
+		case SinkAxiom:
+			client, err := axiom.NewClient(axiom.SetPersonalTokenConfig(cfg.AxiomToken, cfg.AxiomOrgID))
+			if err != nil {
+				out.Close()
+				return nil, fmt.Errorf("failed to create Axiom client: %w", err)
+			}
+			handler, err := adapter.New(
+				adapter.SetDataset(cfg.AxiomDataset),
+				adapter.SetClient(client),
+				adapter.SetLevel(options.Level),
+			)
+			if err != nil {
+				out.Close()
+				return nil, fmt.Errorf("failed to create Axiom handler: %w", err)
+			}
+			out.closers = append(out.closers, func() error {
+				handler.Close()
+				return nil
+			})
+			handlers = append(handlers, handler)
+
+		default:
+			out.Close()
+			return nil, fmt.Errorf("unknown log sink %q", sink)
+		}
+	}
+	if len(handlers) == 0 {
+		return nil, errors.New("no log sinks configured")
+	}
+
+	out.Logger = slog.New(&levelHandler{next: &fanoutHandler{handlers: handlers}, levels: out.Levels})
+	return out, nil
+}
+
+// Flushes and closes every sink.
+func (o *Output) Close() error {
+	var errs []error
+	for _, closeSink := range o.closers {
+		errs = append(errs, closeSink())
+	}
+	return errors.Join(errs...)
+}
+
+func formatHandler(format string, w io.Writer, options *slog.HandlerOptions) (slog.Handler, error) {
+	switch format {
+	case "json":
+		return slog.NewJSONHandler(w, options), nil
+	case "text":
+		return slog.NewTextHandler(w, options), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, expected json or text", format)
+}
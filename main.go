@@ -1,51 +1,64 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
 	"os"
+	"strings"
 
-	"github.com/axiomhq/axiom-go/axiom"
 	"github.com/dantdj/goreel/api"
+	"github.com/dantdj/goreel/config"
+	"github.com/dantdj/goreel/logging"
 	"github.com/joho/godotenv"
-
-	adapter "github.com/axiomhq/axiom-go/adapters/slog"
 )
 
+const usage = `Usage: goreel [command] [flags]
+
+Commands:
+  serve   serve the HTTP API, leaving videos to be processed by workers
+  worker  process videos from the queue, serving health checks and metrics
+          on the port set by GOREEL_WORKER_PORT
+  all     serve the API and process videos in the same process (the default)
+
+Run "goreel <command> -help" to list the flags.
+`
+
 func main() {
 	envErr := godotenv.Load()
 
-	var handler slog.Handler
-	// We only care about creating the Axiom handler if we're not in local mode,
-	// as we shouldn't be logging there by default
-	if os.Getenv("GOREEL_LOCAL") != "true" {
-		client, err := axiom.NewClient(
-			axiom.SetPersonalTokenConfig(os.Getenv("AXIOM_TOKEN"), os.Getenv("AXIOM_ORG_ID")),
-		)
-		if err != nil {
-			slog.Error("Error creating axiom client", slog.String("error", err.Error()))
-			return
-		}
-
-		handler, err := adapter.New(
-			adapter.SetDataset(os.Getenv("AXIOM_DATASET")),
-			adapter.SetClient(client),
-		)
-		if err != nil {
-			slog.Error("Error creating slog handler", slog.String("error", err.Error()))
-			return
-		}
-		defer handler.Close()
+	mode, args := api.ModeAll, os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		mode, args = args[0], args[1:]
+	}
+	switch mode {
+	case api.ModeServe, api.ModeWorker, api.ModeAll:
+	case "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", mode, usage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load("goreel "+mode, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		// Logging isn't set up yet, as it's configured here too
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
 	}
 
-	var logger *slog.Logger
-	// Allow use of JSON output in local environment,
-	// but default to Axiom in production
-	if os.Getenv("GOREEL_LOCAL") == "true" {
-		logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
-	} else {
-		logger = slog.New(handler)
+	logs, err := logging.Open(cfg.Log.Logging())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error setting up logging: %v\n", err)
+		os.Exit(1)
 	}
-	slog.SetDefault(logger)
+	defer logs.Close()
+	slog.SetDefault(logs.Logger)
 
 	if envErr != nil {
 		// Now that we've set up logging, we can log the
@@ -55,9 +68,15 @@ func main() {
 		slog.Info("No .env file found, relying on environment variables")
 	}
 
-	// Start the HTTP server.
-	if err := api.Serve(8089); err != nil {
-		slog.Error("Failed to start server", slog.String("error", err.Error()))
-		return
+	// Secrets are redacted when the config is logged
+	slog.Info("Loaded configuration", slog.Any("config", cfg))
+
+	slog.Info("Starting goreel", slog.String("mode", mode))
+	if err := api.Run(mode, cfg, logs.Levels); err != nil {
+		slog.Error("Failed to run goreel", slog.String("mode", mode), slog.String("error", err.Error()))
+		// Exit non-zero so supervisors restart us, flushing the logs first as
+		// deferred calls are skipped
+		logs.Close()
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,110 @@
+// Package metrics holds the Prometheus collectors shared across the service,
+// so every package reports under the same names and labels.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "goreel"
+
+// Outcomes used for the result label.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by route pattern, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by route pattern and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	UploadBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_bytes_total",
+		Help:      "Bytes of video received through uploads.",
+	})
+
+	QueuePublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_messages_published_total",
+		Help:      "Messages published, by queue and result.",
+	}, []string{"queue", "result"})
+
+	QueueConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_messages_consumed_total",
+		Help:      "Messages consumed, by queue and whether the handler succeeded.",
+	}, []string{"queue", "result"})
+
+	JobsInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "jobs_in_flight",
+		Help:      "Video jobs currently running, by job type.",
+	}, []string{"type"})
+
+	JobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Time taken to run video jobs, by job type and result.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"type", "result"})
+
+	TranscodeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "transcode_duration_seconds",
+		Help:      "Time taken to encode a video's HLS renditions, by encoding profile.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"profile"})
+
+	ToolExits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ffmpeg_exits_total",
+		Help:      "FFmpeg and FFprobe runs, by tool and exit code. Runs that couldn't start have code -1.",
+	}, []string{"tool", "code"})
+
+	StorageOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Time taken by storage operations, by backend and operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"backend", "operation"})
+
+	StorageErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_errors_total",
+		Help:      "Failed storage operations, by backend and operation.",
+	}, []string{"backend", "operation"})
+)
+
+// Returns the label value for whether an operation succeeded.
+func Result(err error) string {
+	if err != nil {
+		return ResultFailure
+	}
+	return ResultSuccess
+}
+
+// Returns the label value for an HTTP status code.
+func Code(status int) string {
+	return strconv.Itoa(status)
+}
+
+// Serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
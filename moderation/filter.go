@@ -0,0 +1,93 @@
+package moderation
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Filter flags text containing any of a list of banned words. Words are
+// matched whole and case-insensitively, so "ass" doesn't catch "class".
+// Phrases of several words are matched as a run of whole words.
+type Filter struct {
+	phrases [][]string
+}
+
+// Creates a filter for the given words and phrases. Blank entries are ignored.
+func NewFilter(words []string) *Filter {
+	f := &Filter{}
+	for _, w := range words {
+		if tokens := tokenize(w); len(tokens) > 0 {
+			f.phrases = append(f.phrases, tokens)
+		}
+	}
+	return f
+}
+
+// Loads a filter from a file with one banned word or phrase per line. Lines
+// starting with "#" are comments. An empty path gives a filter that matches
+// nothing.
+func LoadFilter(path string) (*Filter, error) {
+	if path == "" {
+		return NewFilter(nil), nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening banned words file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading banned words file %s: %w", path, err)
+	}
+	return NewFilter(words), nil
+}
+
+// Reports whether the text contains any banned word or phrase.
+func (f *Filter) Matches(text string) bool {
+	if len(f.phrases) == 0 {
+		return false
+	}
+
+	tokens := tokenize(text)
+	for i := range tokens {
+		for _, phrase := range f.phrases {
+			if hasPhraseAt(tokens, i, phrase) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasPhraseAt(tokens []string, i int, phrase []string) bool {
+	if i+len(phrase) > len(tokens) {
+		return false
+	}
+	for j, word := range phrase {
+		if tokens[i+j] != word {
+			return false
+		}
+	}
+	return true
+}
+
+// Splits text into lowercase words, treating anything other than letters and
+// digits as a separator.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
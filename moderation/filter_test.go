@@ -0,0 +1,26 @@
+package moderation
+
+import "testing"
+
+func TestFilter_Matches(t *testing.T) {
+	f := NewFilter([]string{"spam", "Buy Now", " "})
+
+	tests := map[string]bool{
+		"this is SPAM":             true,
+		"spam!":                    true,
+		"spammer":                  false,
+		"buy   now, cheap":         true,
+		"buy it now":               false,
+		"a perfectly nice comment": false,
+		"":                         false,
+	}
+	for text, want := range tests {
+		if got := f.Matches(text); got != want {
+			t.Errorf("Matches(%q) = %v, want %v", text, got, want)
+		}
+	}
+
+	if NewFilter(nil).Matches("spam") {
+		t.Error("expected an empty filter to match nothing")
+	}
+}
@@ -0,0 +1,46 @@
+package queueing
+
+import (
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Lets trace context be injected into and extracted from message headers.
+type headerCarrier amqp091.Table
+
+var _ propagation.TextMapCarrier = headerCarrier{}
+
+func (h headerCarrier) Get(key string) string {
+	value, _ := h[key].(string)
+	return value
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h[key] = value
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Header counting how many times a message has been retried after its handler
+// failed. Requeues after a shutdown don't count.
+const attemptHeader = "x-goreel-attempt"
+
+// Returns how many times the message with the given headers has been retried.
+func retryAttempt(headers amqp091.Table) int {
+	switch n := headers[attemptHeader].(type) {
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case int:
+		return n
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,68 @@
+package queueing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dantdj/goreel/tracing"
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestHeaderCarrier_PropagatesTraceContext(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.Install(exporter, "test")
+	defer provider.Shutdown(context.Background())
+
+	ctx, publish := tracer.Start(context.Background(), "publish")
+	headers := amqp091.Table{}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(headers))
+	publish.End()
+
+	if _, ok := headers["traceparent"].(string); !ok {
+		t.Fatalf("headers missing traceparent: %v", headers)
+	}
+
+	ctx = otel.GetTextMapPropagator().Extract(context.Background(), headerCarrier(headers))
+	_, consume := tracer.Start(ctx, "consume")
+	consume.End()
+
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("unexpected error flushing spans: %v", err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	if spans[1].Parent.SpanID() != spans[0].SpanContext.SpanID() {
+		t.Errorf("consume span's parent is %s, want the publish span %s", spans[1].Parent.SpanID(), spans[0].SpanContext.SpanID())
+	}
+	if spans[1].SpanContext.TraceID() != spans[0].SpanContext.TraceID() {
+		t.Errorf("consume span is in trace %s, want %s", spans[1].SpanContext.TraceID(), spans[0].SpanContext.TraceID())
+	}
+}
+
+func TestHeaderCarrier_IgnoresNonStringHeaders(t *testing.T) {
+	headers := headerCarrier(amqp091.Table{"traceparent": int32(1)})
+	if got := headers.Get("traceparent"); got != "" {
+		t.Errorf("got %q, want an empty string", got)
+	}
+}
+
+func TestRetryAttempt(t *testing.T) {
+	tests := map[string]struct {
+		headers  amqp091.Table
+		expected int
+	}{
+		"missing": {nil, 0},
+		"int32":   {amqp091.Table{attemptHeader: int32(1)}, 1},
+		"int64":   {amqp091.Table{attemptHeader: int64(2)}, 2},
+		"string":  {amqp091.Table{attemptHeader: "1"}, 0},
+	}
+	for name, tt := range tests {
+		if got := retryAttempt(tt.headers); got != tt.expected {
+			t.Errorf("%s: expected %d, got %d", name, tt.expected, got)
+		}
+	}
+}
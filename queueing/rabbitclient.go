@@ -1,21 +1,47 @@
 package queueing
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
 
+	"github.com/dantdj/goreel/metrics"
+	"github.com/dantdj/goreel/tracing"
 	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/dantdj/goreel/queueing")
+
+// ErrPermanent marks handler errors that retrying won't fix, such as a message
+// that can't be parsed. Messages failing with it are dead-lettered straight away.
+var ErrPermanent = errors.New("permanent failure")
+
+// How many times a failed message is retried before it's dead-lettered.
+const maxRetries = 1
+
 type Client struct {
 	conn *amqp091.Connection
 	ch   *amqp091.Channel
 	url  string
 	mu   sync.Mutex
+
+	// Tags of the consumers started, so they can be cancelled
+	consumers []string
+	// Tracks each consumer's delivery loop and the handlers it's running
+	inFlight sync.WaitGroup
+	// Context for running handlers, cancelled when shutdown gives up waiting for them
+	handlerCtx    context.Context
+	cancelHandler context.CancelFunc
 }
 
-func NewRabbitClient(url string) (*Client, error) {
+// Connects to the broker at url, delivering at most prefetch unacknowledged
+// messages to consumers at a time.
+func NewRabbitClient(url string, prefetch int) (*Client, error) {
 	conn, err := amqp091.Dial(url)
 	if err != nil {
 		return nil, fmt.Errorf("error creating RabbitMQ connection: %w", err)
@@ -27,21 +53,25 @@ func NewRabbitClient(url string) (*Client, error) {
 		return nil, fmt.Errorf("error creating RabbitMQ channel: %w", err)
 	}
 
-	// Only allow one message to be processed at a time
-	if err := ch.Qos(1, 0, false); err != nil {
+	// Limit how many messages are processed at once
+	if err := ch.Qos(prefetch, 0, false); err != nil {
 		ch.Close()
 		conn.Close()
 		return nil, fmt.Errorf("error setting Qos: %w", err)
 	}
 
+	handlerCtx, cancelHandler := context.WithCancel(context.Background())
 	return &Client{
-		conn: conn,
-		ch:   ch,
-		url:  url,
+		conn:          conn,
+		ch:            ch,
+		url:           url,
+		handlerCtx:    handlerCtx,
+		cancelHandler: cancelHandler,
 	}, nil
 }
 
 func (c *Client) Close() error {
+	c.cancelHandler()
 	if err := c.ch.Close(); err != nil {
 		// We still try to close the connection even if channel close fails
 		c.conn.Close()
@@ -53,24 +83,69 @@ func (c *Client) Close() error {
 	return nil
 }
 
-// Ensures that a queue with the given name exists.
+// Returns an error if the connection to the broker or the channel has closed.
+func (c *Client) Ping() error {
+	if c.conn.IsClosed() {
+		return errors.New("connection to RabbitMQ is closed")
+	}
+	if c.ch.IsClosed() {
+		return errors.New("RabbitMQ channel is closed")
+	}
+	return nil
+}
+
+// Ensures that a queue with the given name exists, along with the queue its
+// failed messages are dead-lettered to. Fails if the queue was already
+// declared without dead-lettering.
 func (c *Client) EnsureQueue(queue string) error {
 	_, err := c.ch.QueueDeclare(
+		DeadLetterQueue(queue), // name
+		false,                  // durable
+		false,                  // auto-delete
+		false,                  // exclusive
+		false,                  // no-wait
+		nil,                    // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare queue %s: %w", DeadLetterQueue(queue), err)
+	}
+
+	_, err = c.ch.QueueDeclare(
 		queue, // name
 		false, // durable
 		false, // auto-delete
 		false, // exclusive
 		false, // no-wait
-		nil,   // arguments
+		amqp091.Table{ // arguments
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": DeadLetterQueue(queue),
+		},
 	)
+	var amqpErr *amqp091.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp091.PreconditionFailed {
+		// Queues can't be given dead-lettering after they've been declared
+		return fmt.Errorf("queue %s already exists without dead-lettering, drain and delete it or choose another name: %w", queue, err)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to declare queue %s: %w", queue, err)
 	}
 	return nil
 }
 
-// Sends a byte payload to the named queue.
-func (c *Client) Publish(queue string, body []byte) error {
+// Returns the name of the queue that messages from queue are dead-lettered to.
+func DeadLetterQueue(queue string) string {
+	return queue + ".dead"
+}
+
+// Sends a byte payload to the named queue. The trace context in ctx is sent in
+// the message headers, so the consumer's work joins the same trace.
+func (c *Client) Publish(ctx context.Context, queue string, body []byte) error {
+	ctx, span := tracer.Start(ctx, queue+" publish", trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("messaging.system", "rabbitmq"), attribute.String("messaging.destination.name", queue)))
+
+	headers := amqp091.Table{}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(headers))
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -81,9 +156,12 @@ func (c *Client) Publish(queue string, body []byte) error {
 		false,
 		amqp091.Publishing{
 			ContentType: "application/json",
+			Headers:     headers,
 			Body:        body,
 		},
 	)
+	metrics.QueuePublished.WithLabelValues(queue, metrics.Result(err)).Inc()
+	tracing.End(span, err)
 	if err != nil {
 		return fmt.Errorf("failed to publish message to queue %s: %w", queue, err)
 	}
@@ -92,11 +170,22 @@ func (c *Client) Publish(queue string, body []byte) error {
 }
 
 // Registers a consumer for the given queue name, processing messages with the provided handler function.
-func (c *Client) StartConsumer(queue string, handler func([]byte) error) error {
+// The handler's context carries the trace context the message was published with, and is cancelled if
+// shutdown gives up waiting for it.
+//
+// Messages are acknowledged once the handler succeeds. Messages the handler fails are published again to
+// be retried once, then dead-lettered, while those failing with ErrPermanent are dead-lettered straight
+// away. Messages interrupted by shutdown are requeued without counting as a retry.
+func (c *Client) StartConsumer(queue string, handler func(context.Context, []byte) error) error {
+	c.mu.Lock()
+	tag := fmt.Sprintf("%s-%d", queue, len(c.consumers))
+	c.consumers = append(c.consumers, tag)
+	c.mu.Unlock()
+
 	msgs, err := c.ch.Consume(
 		queue, // name
-		"",    // consumer
-		true,  // auto-ack
+		tag,   // consumer
+		false, // auto-ack
 		false, // exclusive
 		false, // no-local
 		false, // no-wait
@@ -106,22 +195,110 @@ func (c *Client) StartConsumer(queue string, handler func([]byte) error) error {
 		return fmt.Errorf("failed to consume queue %s: %w", queue, err)
 	}
 
+	c.inFlight.Add(1)
 	go func() {
+		defer c.inFlight.Done()
+
 		for d := range msgs {
-			go func(b []byte) {
-				defer func() {
-					if r := recover(); r != nil {
-						slog.Error("panic in consumer handler", slog.Any("recover", r))
-					}
-				}()
-
-				if err := handler(b); err != nil {
-					slog.Error("Consumer handler failed", slog.String("queue", queue), slog.String("error", err.Error()))
-				}
-			}(d.Body)
+			c.inFlight.Add(1)
+			go func(d amqp091.Delivery) {
+				defer c.inFlight.Done()
+				c.handle(queue, d, handler)
+			}(d)
 		}
 		slog.Info("consumer channel closed for queue", slog.String("queue", queue))
 	}()
 
 	return nil
 }
+
+// Runs the handler for a delivery, then acknowledges or rejects it depending on the result.
+func (c *Client) handle(queue string, d amqp091.Delivery, handler func(context.Context, []byte) error) {
+	ctx := otel.GetTextMapPropagator().Extract(c.handlerCtx, headerCarrier(d.Headers))
+	ctx, span := tracer.Start(ctx, queue+" process", trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("messaging.system", "rabbitmq"), attribute.String("messaging.destination.name", queue)))
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic in consumer handler: %v", r)
+			}
+		}()
+		return handler(ctx, d.Body)
+	}()
+	metrics.QueueConsumed.WithLabelValues(queue, metrics.Result(err)).Inc()
+	tracing.End(span, err)
+
+	var ackErr error
+	switch {
+	case err == nil:
+		ackErr = d.Ack(false)
+	case c.handlerCtx.Err() != nil:
+		slog.Warn("Requeued message interrupted by shutdown", slog.String("queue", queue), slog.String("error", err.Error()))
+		ackErr = d.Nack(false, true)
+	case errors.Is(err, ErrPermanent) || retryAttempt(d.Headers) >= maxRetries:
+		slog.Error("Dead-lettered failed message", slog.String("queue", queue), slog.String("error", err.Error()))
+		ackErr = d.Nack(false, false)
+	default:
+		// The retry is published as a new message so it can carry its attempt count
+		if pubErr := c.retry(queue, d); pubErr != nil {
+			slog.Error("Failed to publish retry, requeueing message", slog.String("queue", queue), slog.String("error", pubErr.Error()))
+			ackErr = d.Nack(false, true)
+			break
+		}
+		slog.Warn("Queued failed message for a retry", slog.String("queue", queue), slog.String("error", err.Error()))
+		ackErr = d.Ack(false)
+	}
+	if ackErr != nil {
+		// The broker requeues unacknowledged messages when the channel closes
+		slog.Error("Failed to acknowledge message", slog.String("queue", queue), slog.String("error", ackErr.Error()))
+	}
+}
+
+// Publishes a copy of a delivery back to its queue, with its retry attempt
+// count incremented.
+func (c *Client) retry(queue string, d amqp091.Delivery) error {
+	headers := amqp091.Table{}
+	for key, value := range d.Headers {
+		headers[key] = value
+	}
+	headers[attemptHeader] = int32(retryAttempt(d.Headers) + 1)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ch.Publish("", queue, false, false, amqp091.Publishing{
+		ContentType: d.ContentType,
+		Headers:     headers,
+		Body:        d.Body,
+	})
+}
+
+// Stops every consumer from taking new messages, then waits for the handlers
+// already running to finish. If they're still running when ctx is done, their
+// contexts are cancelled so their messages are requeued, and ctx's error is
+// returned.
+func (c *Client) StopConsumers(ctx context.Context) error {
+	c.mu.Lock()
+	for _, tag := range c.consumers {
+		if err := c.ch.Cancel(tag, false); err != nil {
+			slog.Error("Failed to cancel consumer", slog.String("consumer", tag), slog.String("error", err.Error()))
+		}
+	}
+	c.consumers = nil
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		c.cancelHandler()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/dantdj/goreel/metrics"
+)
+
+// Instrumented wraps a Service, recording the latency and failures of each
+// operation under the given backend name.
+type Instrumented struct {
+	Service
+	backend string
+}
+
+// Creates an Instrumented wrapper around the given Service.
+func NewInstrumented(s Service, backend string) *Instrumented {
+	return &Instrumented{Service: s, backend: backend}
+}
+
+func (i *Instrumented) Upload(fileReader io.Reader, name string) string {
+	start := time.Now()
+	location := i.Service.Upload(fileReader, name)
+	i.observe("upload", start, location == "")
+	return location
+}
+
+func (i *Instrumented) Retrieve(blobName string) (io.ReadCloser, int64, string) {
+	start := time.Now()
+	data, contentLength, contentType := i.Service.Retrieve(blobName)
+	i.observe("retrieve", start, data == nil)
+	return data, contentLength, contentType
+}
+
+func (i *Instrumented) Delete(blobName string) error {
+	start := time.Now()
+	err := i.Service.Delete(blobName)
+	// A blob that's already gone is an expected outcome, not a failure
+	i.observe("delete", start, err != nil && !errors.Is(err, ErrNotFound))
+	return err
+}
+
+func (i *Instrumented) List(prefix string) ([]string, error) {
+	start := time.Now()
+	names, err := i.Service.List(prefix)
+	i.observe("list", start, err != nil)
+	return names, err
+}
+
+func (i *Instrumented) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := i.Service.Ping(ctx)
+	i.observe("ping", start, err != nil)
+	return err
+}
+
+func (i *Instrumented) observe(operation string, start time.Time, failed bool) {
+	metrics.StorageOperationDuration.WithLabelValues(i.backend, operation).Observe(time.Since(start).Seconds())
+	if failed {
+		metrics.StorageErrors.WithLabelValues(i.backend, operation).Inc()
+	}
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/dantdj/goreel/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type fakeService struct {
+	deleteErr error
+}
+
+func (f *fakeService) Upload(fileReader io.Reader, name string) string { return "" }
+
+func (f *fakeService) Retrieve(blobName string) (io.ReadCloser, int64, string) {
+	return nil, 0, ""
+}
+
+func (f *fakeService) Delete(blobName string) error { return f.deleteErr }
+
+func (f *fakeService) List(prefix string) ([]string, error) { return nil, nil }
+
+func (f *fakeService) Ping(ctx context.Context) error { return nil }
+
+func TestInstrumented_DeleteNotFoundIsNotAnError(t *testing.T) {
+	s := NewInstrumented(&fakeService{deleteErr: ErrNotFound}, "test-not-found")
+
+	if err := s.Delete("blob"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got error %v, want ErrNotFound", err)
+	}
+	if got := testutil.ToFloat64(metrics.StorageErrors.WithLabelValues("test-not-found", "delete")); got != 0 {
+		t.Errorf("got %v delete errors, want 0", got)
+	}
+}
+
+func TestInstrumented_CountsFailures(t *testing.T) {
+	s := NewInstrumented(&fakeService{deleteErr: errors.New("boom")}, "test-failures")
+
+	s.Delete("blob")
+	s.Upload(nil, "blob")
+
+	if got := testutil.ToFloat64(metrics.StorageErrors.WithLabelValues("test-failures", "delete")); got != 1 {
+		t.Errorf("got %v delete errors, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.StorageErrors.WithLabelValues("test-failures", "upload")); got != 1 {
+		t.Errorf("got %v upload errors, want 1", got)
+	}
+}
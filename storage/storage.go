@@ -2,19 +2,27 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
 )
 
+// ErrNotFound is returned when deleting a blob that doesn't exist.
+var ErrNotFound = errors.New("blob not found")
+
 // Service defines the interface for storage operations
 type Service interface {
 	Upload(fileReader io.Reader, name string) string
 	Retrieve(blobName string) (io.ReadCloser, int64, string)
 	Delete(blobName string) error
+	List(prefix string) ([]string, error)
+	// Checks that storage can be reached
+	Ping(ctx context.Context) error
 }
 
 // AzureBlobStorage implements the Service interface for Azure Blob Storage.
@@ -75,9 +83,12 @@ func (abs *AzureBlobStorage) Retrieve(blobName string) (io.ReadCloser, int64, st
 	return downloadResponse.Body, *downloadResponse.ContentLength, *downloadResponse.ContentType
 }
 
-// Deletes the blob with the given name.
+// Deletes the blob with the given name. Returns ErrNotFound if there's no such blob.
 func (abs *AzureBlobStorage) Delete(blobName string) error {
 	_, err := abs.client.DeleteBlob(context.Background(), abs.containerName, blobName, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return ErrNotFound
+	}
 	if err != nil {
 		slog.Error("Error deleting blob", slog.String("error", err.Error()))
 		return err
@@ -86,3 +97,29 @@ func (abs *AzureBlobStorage) Delete(blobName string) error {
 	slog.Info("Deleted blob", slog.String("name", blobName))
 	return nil
 }
+
+// Fetches the container's properties, as a cheap check that the storage
+// account is reachable and the credentials work.
+func (abs *AzureBlobStorage) Ping(ctx context.Context) error {
+	_, err := abs.client.ServiceClient().NewContainerClient(abs.containerName).GetProperties(ctx, nil)
+	return err
+}
+
+// Lists the names of all blobs starting with the given prefix.
+func (abs *AzureBlobStorage) List(prefix string) ([]string, error) {
+	var names []string
+
+	pager := abs.client.NewListBlobsFlatPager(abs.containerName, &azblob.ListBlobsFlatOptions{Prefix: &prefix})
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		if err != nil {
+			slog.Error("Error listing blobs", slog.String("prefix", prefix), slog.String("error", err.Error()))
+			return nil, err
+		}
+		for _, item := range page.Segment.BlobItems {
+			names = append(names, *item.Name)
+		}
+	}
+
+	return names, nil
+}
@@ -0,0 +1,66 @@
+// Package tracing sets up OpenTelemetry tracing for the service. Spans are
+// exported over OTLP/HTTP, configured through the standard OTEL_EXPORTER_OTLP_*
+// environment variables, and trace context is propagated in W3C traceparent
+// headers.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Sets up tracing for the named service. Spans are only exported when enabled;
+// otherwise trace context is still propagated, so traces started upstream
+// aren't broken. The returned function flushes any buffered spans and should be
+// called on shutdown.
+func Setup(ctx context.Context, serviceName string, export bool) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if !export {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := Install(exporter, serviceName)
+	return provider.Shutdown, nil
+}
+
+// Registers a global tracer provider that batches spans to the given exporter,
+// and returns it. Tests can pass an in-memory exporter to inspect the spans.
+func Install(exporter sdktrace.SpanExporter, serviceName string) *sdktrace.TracerProvider {
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	if err != nil {
+		// Only happens if the schema URLs conflict, and the service name alone will do
+		res = resource.NewSchemaless(attribute.String("service.name", serviceName))
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider
+}
+
+// Ends a span, first marking it as failed if err isn't nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
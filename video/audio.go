@@ -0,0 +1,97 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/dantdj/goreel/logging"
+)
+
+const (
+	audioRenditionDir  = "audio"
+	audioRenditionName = "audio"
+	// AAC-LC, which is what FFmpeg's native aac encoder produces
+	aacCodecs = "mp4a.40.2"
+)
+
+// Returns the playlist path for the audio-only rendition, relative to the video's master playlist.
+func audioPlaylistPath() string {
+	return filepath.ToSlash(filepath.Join(audioRenditionDir, hlsPlaylistName))
+}
+
+// Returns the file name of the standalone audio download for the given format.
+func audioDownloadName(format string) string {
+	return "audio." + format
+}
+
+// Creates the audio-only HLS rendition and the standalone download file in baseDir.
+// Returns false without an error if the input has no audio stream.
+func (p *Processor) generateAudioOnly(ctx context.Context, profile Profile, videoPath, baseDir, audioFilter string) (bool, error) {
+	logger := logging.FromContext(ctx)
+
+	outputDir := filepath.Join(baseDir, audioRenditionDir)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return false, fmt.Errorf("failed to make audio directory %s: %w", outputDir, err)
+	}
+
+	var filterArgs []string
+	if audioFilter != "" {
+		filterArgs = []string{"-af", audioFilter, "-ar", "48000"}
+	}
+
+	downloadCodec := "aac"
+	if profile.AudioOnly.DownloadFormat == "mp3" {
+		downloadCodec = "libmp3lame"
+	}
+
+	args := []string{"-i", videoPath} // Input file
+
+	// First output: the low-bitrate HLS rendition
+	args = append(args,
+		"-map", "0:a:0?", // First source audio stream only, the same one the video renditions use
+		"-codec:a", "aac", // Audio codec
+		"-b:a", strconv.Itoa(profile.AudioOnly.Bitrate), // Audio bitrate
+	)
+	args = append(args, filterArgs...)
+	args = append(args,
+		"-f", "hls", // Output format HLS
+		"-hls_time", strconv.Itoa(profile.SegmentSeconds), // Match the video segment duration
+		"-hls_playlist_type", "vod", // VOD for on-demand playback
+		"-hls_segment_filename", filepath.Join(outputDir, "segment_%03d.ts"), // Path for segments
+		filepath.Join(outputDir, hlsPlaylistName), // Path for the audio playlist
+	)
+
+	// Second output: the standalone download, at the full audio bitrate
+	args = append(args,
+		"-map", "0:a:0?", // First source audio stream only
+		"-codec:a", downloadCodec, // Audio codec
+		"-b:a", strconv.Itoa(profile.AudioBitrate), // Audio bitrate
+	)
+	args = append(args, filterArgs...)
+	if profile.AudioOnly.DownloadFormat == "m4a" {
+		args = append(args, "-movflags", "+faststart") // Allow playback to start before the download finishes
+	}
+	args = append(args, filepath.Join(baseDir, audioDownloadName(profile.AudioOnly.DownloadFormat)))
+
+	logger.Info("Running FFmpeg for audio-only outputs with args", slog.String("args", fmt.Sprintf("%v", args)))
+
+	output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	observeExit("ffmpeg", err)
+	if err != nil {
+		if bytes.Contains(output, []byte("does not contain any stream")) {
+			// Nothing will have been written, but clear up the empty directory
+			os.RemoveAll(outputDir)
+			return false, nil
+		}
+		logger.Error("FFmpeg failed", slog.String("output", string(output)), slog.String("error", err.Error()))
+		return false, fmt.Errorf("FFmpeg failed: %w", err)
+	}
+
+	return true, nil
+}
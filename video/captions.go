@@ -0,0 +1,291 @@
+package video
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Caption segments are longer than video segments, as there are far fewer cues
+// than frames and players only need the next few seconds' worth at a time.
+const captionSegmentDuration = 10 * time.Second
+
+// FFmpeg's HLS muxer starts MPEG-TS timestamps at 1.4s, so caption cues are
+// mapped onto that offset to stay in sync with the video segments.
+const captionTimestampMap = "X-TIMESTAMP-MAP=MPEGTS:126000,LOCAL:00:00:00.000"
+
+// Cue is a single timed block of caption text.
+type Cue struct {
+	Start    time.Duration
+	End      time.Duration
+	Settings string
+	Text     string
+}
+
+// CaptionSegment is a slice of a caption track covering one HLS segment.
+type CaptionSegment struct {
+	Name     string
+	Duration time.Duration
+	Cues     []Cue
+}
+
+// Parses a caption file in either SRT or WebVTT format, detecting which one
+// based on the presence of the WEBVTT header.
+func ParseCaptions(data []byte) ([]Cue, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("WEBVTT")) {
+		return ParseWebVTT(bytes.NewReader(data))
+	}
+	return ParseSRT(bytes.NewReader(data))
+}
+
+// Parses an SRT file into cues.
+func ParseSRT(r io.Reader) ([]Cue, error) {
+	blocks, err := readBlocks(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var cues []Cue
+	for _, block := range blocks {
+		// The numeric counter line is optional in practice, so look for the timing line
+		// in either of the first two lines.
+		timingIndex := 0
+		if !strings.Contains(block[0], "-->") {
+			timingIndex = 1
+		}
+		if timingIndex >= len(block) || !strings.Contains(block[timingIndex], "-->") {
+			return nil, fmt.Errorf("invalid SRT cue: missing timing line in %q", strings.Join(block, "\n"))
+		}
+
+		cue, err := parseTimingLine(strings.ReplaceAll(block[timingIndex], ",", "."))
+		if err != nil {
+			return nil, err
+		}
+		// SRT positioning coordinates aren't representable as WebVTT settings
+		cue.Settings = ""
+		cue.Text = strings.Join(block[timingIndex+1:], "\n")
+		cues = append(cues, cue)
+	}
+
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("no cues found in SRT file")
+	}
+	return cues, nil
+}
+
+// Parses a WebVTT file into cues. NOTE, STYLE and REGION blocks are skipped.
+func ParseWebVTT(r io.Reader) ([]Cue, error) {
+	blocks, err := readBlocks(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks) == 0 || !strings.HasPrefix(blocks[0][0], "WEBVTT") {
+		return nil, fmt.Errorf("missing WEBVTT header")
+	}
+
+	var cues []Cue
+	for _, block := range blocks[1:] {
+		first := block[0]
+		if strings.HasPrefix(first, "NOTE") || first == "STYLE" || first == "REGION" {
+			continue
+		}
+
+		// Cue identifiers are optional
+		timingIndex := 0
+		if !strings.Contains(first, "-->") {
+			timingIndex = 1
+		}
+		if timingIndex >= len(block) || !strings.Contains(block[timingIndex], "-->") {
+			return nil, fmt.Errorf("invalid WebVTT cue: missing timing line in %q", strings.Join(block, "\n"))
+		}
+
+		cue, err := parseTimingLine(block[timingIndex])
+		if err != nil {
+			return nil, err
+		}
+		cue.Text = strings.Join(block[timingIndex+1:], "\n")
+		cues = append(cues, cue)
+	}
+
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("no cues found in WebVTT file")
+	}
+	return cues, nil
+}
+
+// Writes the cues out as a complete WebVTT document.
+func WriteWebVTT(w io.Writer, cues []Cue) error {
+	return writeWebVTT(w, "", cues)
+}
+
+// Splits the cues into fixed-length segments for HLS delivery. A cue that spans
+// a segment boundary is repeated in each segment it overlaps, as the spec requires.
+func SegmentCaptions(cues []Cue, segmentDuration time.Duration) []CaptionSegment {
+	var end time.Duration
+	for _, c := range cues {
+		end = max(end, c.End)
+	}
+
+	count := int(math.Ceil(float64(end) / float64(segmentDuration)))
+	segments := make([]CaptionSegment, 0, count)
+	for i := range count {
+		segStart := time.Duration(i) * segmentDuration
+		segEnd := min(segStart+segmentDuration, end)
+
+		segment := CaptionSegment{
+			Name:     fmt.Sprintf("segment_%03d.vtt", i),
+			Duration: segEnd - segStart,
+		}
+		for _, c := range cues {
+			if c.Start < segEnd && c.End > segStart {
+				segment.Cues = append(segment.Cues, c)
+			}
+		}
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// Writes a single caption segment, including the timestamp map HLS players
+// need to line it up against the MPEG-TS video segments.
+func (s CaptionSegment) Write(w io.Writer) error {
+	return writeWebVTT(w, captionTimestampMap, s.Cues)
+}
+
+// Builds the VOD media playlist listing the given caption segments.
+func CaptionPlaylist(segments []CaptionSegment) string {
+	var target time.Duration
+	for _, s := range segments {
+		target = max(target, s.Duration)
+	}
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(target.Seconds())))
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
+	b.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	for _, s := range segments {
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", s.Duration.Seconds(), s.Name)
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return b.String()
+}
+
+func writeWebVTT(w io.Writer, header string, cues []Cue) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("WEBVTT\n")
+	if header != "" {
+		bw.WriteString(header + "\n")
+	}
+	for _, c := range cues {
+		bw.WriteString("\n")
+		bw.WriteString(formatTimestamp(c.Start) + " --> " + formatTimestamp(c.End))
+		if c.Settings != "" {
+			bw.WriteString(" " + c.Settings)
+		}
+		bw.WriteString("\n" + c.Text + "\n")
+	}
+	return bw.Flush()
+}
+
+// Splits the input into blank-line separated blocks of trimmed lines.
+func readBlocks(r io.Reader) ([][]string, error) {
+	var blocks [][]string
+	var current []string
+
+	scanner := bufio.NewScanner(r)
+	first := true
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+
+		if strings.TrimSpace(line) == "" {
+			if len(current) > 0 {
+				blocks = append(blocks, current)
+				current = nil
+			}
+			continue
+		}
+		current = append(current, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading captions: %w", err)
+	}
+	if len(current) > 0 {
+		blocks = append(blocks, current)
+	}
+	return blocks, nil
+}
+
+// Parses a "start --> end [settings]" line using WebVTT timestamp syntax.
+func parseTimingLine(line string) (Cue, error) {
+	startText, rest, _ := strings.Cut(line, "-->")
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return Cue{}, fmt.Errorf("invalid cue timing %q", line)
+	}
+
+	start, err := parseTimestamp(strings.TrimSpace(startText))
+	if err != nil {
+		return Cue{}, err
+	}
+	end, err := parseTimestamp(fields[0])
+	if err != nil {
+		return Cue{}, err
+	}
+	if end < start {
+		return Cue{}, fmt.Errorf("cue ends before it starts: %q", line)
+	}
+
+	return Cue{Start: start, End: end, Settings: strings.Join(fields[1:], " ")}, nil
+}
+
+// Parses "hh:mm:ss.ttt" or "mm:ss.ttt" into a duration.
+func parseTimestamp(s string) (time.Duration, error) {
+	clock, fraction, _ := strings.Cut(s, ".")
+	parts := strings.Split(clock, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+
+	var total time.Duration
+	units := []time.Duration{time.Second, time.Minute, time.Hour}
+	for i := range parts {
+		n, err := strconv.Atoi(parts[len(parts)-1-i])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid timestamp %q", s)
+		}
+		total += time.Duration(n) * units[i]
+	}
+
+	if fraction != "" {
+		// Pad or truncate to milliseconds, so "5" means 500ms
+		fraction = (fraction + "000")[:3]
+		ms, err := strconv.Atoi(fraction)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", s)
+		}
+		total += time.Duration(ms) * time.Millisecond
+	}
+	return total, nil
+}
+
+func formatTimestamp(d time.Duration) string {
+	h := d / time.Hour
+	d -= h * time.Hour
+	m := d / time.Minute
+	d -= m * time.Minute
+	s := d / time.Second
+	d -= s * time.Second
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", h, m, s, d/time.Millisecond)
+}
@@ -0,0 +1,86 @@
+package video
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleSRT = "1\r\n00:00:01,500 --> 00:00:04,000\r\nHello there\r\n\r\n2\r\n00:00:09,000 --> 00:00:12,250\r\nGeneral Kenobi\r\nYou are a bold one\r\n"
+
+func TestParseCaptions_SRT(t *testing.T) {
+	cues, err := ParseCaptions([]byte(sampleSRT))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cues) != 2 {
+		t.Fatalf("expected 2 cues, got %d", len(cues))
+	}
+	if cues[0].Start != 1500*time.Millisecond || cues[0].End != 4*time.Second {
+		t.Errorf("unexpected timing for first cue: %v --> %v", cues[0].Start, cues[0].End)
+	}
+	if cues[1].Text != "General Kenobi\nYou are a bold one" {
+		t.Errorf("unexpected text for second cue: %q", cues[1].Text)
+	}
+}
+
+func TestParseCaptions_WebVTT(t *testing.T) {
+	input := "WEBVTT\n\nNOTE a comment\n\nintro\n00:01.000 --> 00:02.000 align:start\nHi\n"
+	cues, err := ParseCaptions([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cues) != 1 {
+		t.Fatalf("expected 1 cue, got %d", len(cues))
+	}
+	if cues[0].Settings != "align:start" {
+		t.Errorf("expected settings to be kept, got %q", cues[0].Settings)
+	}
+}
+
+func TestParseCaptions_Invalid(t *testing.T) {
+	if _, err := ParseCaptions([]byte("not a caption file")); err == nil {
+		t.Error("expected an error for invalid input")
+	}
+}
+
+func TestWriteWebVTT_ConvertsSRT(t *testing.T) {
+	cues, err := ParseSRT(strings.NewReader(sampleSRT))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteWebVTT(&buf, cues); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "WEBVTT\n\n00:00:01.500 --> 00:00:04.000\nHello there\n\n00:00:09.000 --> 00:00:12.250\nGeneral Kenobi\nYou are a bold one\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestSegmentCaptions_SpanningCue(t *testing.T) {
+	cues := []Cue{
+		{Start: 2 * time.Second, End: 4 * time.Second, Text: "a"},
+		{Start: 9 * time.Second, End: 12 * time.Second, Text: "b"},
+	}
+
+	segments := SegmentCaptions(cues, 10*time.Second)
+	if len(segments) != 2 {
+		t.Fatalf("expected 2 segments, got %d", len(segments))
+	}
+	if len(segments[0].Cues) != 2 || len(segments[1].Cues) != 1 {
+		t.Errorf("expected spanning cue in both segments, got %d and %d cues", len(segments[0].Cues), len(segments[1].Cues))
+	}
+	if segments[1].Duration != 2*time.Second {
+		t.Errorf("expected final segment to be 2s, got %v", segments[1].Duration)
+	}
+
+	playlist := CaptionPlaylist(segments)
+	if !strings.Contains(playlist, "#EXT-X-TARGETDURATION:10\n") || !strings.HasSuffix(playlist, "#EXT-X-ENDLIST\n") {
+		t.Errorf("unexpected playlist:\n%s", playlist)
+	}
+}
@@ -0,0 +1,105 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+)
+
+const captionPlaylistName = "captions.m3u8"
+
+// Returns the storage prefix holding all files for a video's caption track.
+func captionPrefix(videoId, language string) string {
+	return BlobName(videoId, path.Join("captions", language)) + "/"
+}
+
+// Returns the playlist path for a caption track, relative to the video's master playlist.
+func CaptionPlaylistPath(language string) string {
+	return path.Join("captions", language, captionPlaylistName)
+}
+
+// Writes the cues out as WebVTT, segments them for HLS and uploads the result,
+// replacing any existing track for the same language.
+func (p *Processor) PublishCaptions(ctx context.Context, caption *database.Caption, cues []Cue) error {
+	logger := logging.FromContext(ctx)
+
+	prefix := captionPrefix(caption.VideoID, caption.Language)
+	existing, err := p.Storage.List(prefix)
+	if err != nil {
+		return fmt.Errorf("failed to list existing captions: %w", err)
+	}
+
+	var full bytes.Buffer
+	if err := WriteWebVTT(&full, cues); err != nil {
+		return fmt.Errorf("failed to write WebVTT: %w", err)
+	}
+	uploaded := []string{prefix + "captions.vtt"}
+	if p.Storage.Upload(&full, uploaded[0]) == "" {
+		return fmt.Errorf("failed to upload WebVTT track")
+	}
+
+	segments := SegmentCaptions(cues, captionSegmentDuration)
+	for _, segment := range segments {
+		var buf bytes.Buffer
+		if err := segment.Write(&buf); err != nil {
+			return fmt.Errorf("failed to write caption segment %s: %w", segment.Name, err)
+		}
+		name := prefix + segment.Name
+		if p.Storage.Upload(&buf, name) == "" {
+			return fmt.Errorf("failed to upload caption segment %s", segment.Name)
+		}
+		uploaded = append(uploaded, name)
+	}
+
+	playlistName := prefix + captionPlaylistName
+	if p.Storage.Upload(strings.NewReader(CaptionPlaylist(segments)), playlistName) == "" {
+		return fmt.Errorf("failed to upload caption playlist")
+	}
+	uploaded = append(uploaded, playlistName)
+
+	// Clear out segments left over from a longer track this one replaced
+	for _, name := range existing {
+		if !slices.Contains(uploaded, name) {
+			if err := p.Storage.Delete(name); err != nil {
+				logger.Error("Failed to delete stale caption file", slog.String("name", name), slog.String("error", err.Error()))
+			}
+		}
+	}
+
+	if err := p.DB.UpsertCaption(ctx, caption); err != nil {
+		return err
+	}
+
+	logger.Info("Published captions",
+		slog.String("video_id", caption.VideoID),
+		slog.String("language", caption.Language),
+		slog.Int("segments", len(segments)))
+	return nil
+}
+
+// Removes a caption track's record and all of its files from storage.
+func (p *Processor) RemoveCaptions(ctx context.Context, videoId, language string) error {
+	if err := p.DB.DeleteCaption(ctx, videoId, language); err != nil {
+		return err
+	}
+
+	names, err := p.Storage.List(captionPrefix(videoId, language))
+	if err != nil {
+		return fmt.Errorf("failed to list caption files: %w", err)
+	}
+	for _, name := range names {
+		if err := p.Storage.Delete(name); err != nil {
+			return fmt.Errorf("failed to delete caption file %s: %w", name, err)
+		}
+	}
+
+	logging.FromContext(ctx).Info("Removed captions", slog.String("video_id", videoId), slog.String("language", language))
+	return nil
+}
@@ -0,0 +1,87 @@
+package video
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dantdj/goreel/database"
+)
+
+// Proposes chapter start times from scene changes. The first chapter always starts
+// at zero, and no chapter is shorter than minSpacing, including the last one.
+func detectChapters(scores []frameScore, threshold, minSpacing, duration float64) []float64 {
+	starts := []float64{0}
+	for _, s := range scores {
+		if s.Score < threshold {
+			continue
+		}
+		if s.Time-starts[len(starts)-1] < minSpacing || duration-s.Time < minSpacing {
+			continue
+		}
+		starts = append(starts, s.Time)
+	}
+	return starts
+}
+
+// Builds default chapter records for detected start times.
+func chaptersFromStarts(starts []float64) []database.Chapter {
+	chapters := make([]database.Chapter, len(starts))
+	for i, start := range starts {
+		chapters[i] = database.Chapter{Start: start, Title: fmt.Sprintf("Chapter %d", i+1)}
+	}
+	return chapters
+}
+
+// Writes the chapters as a WebVTT chapters track, with each chapter running until
+// the next one starts and the last running to the end of the video.
+func WriteChaptersWebVTT(w io.Writer, chapters []database.Chapter, duration float64) error {
+	cues := make([]Cue, len(chapters))
+	for i, c := range chapters {
+		cues[i] = Cue{
+			Start: secondsToDuration(c.Start),
+			End:   secondsToDuration(chapterEnd(chapters, i, duration)),
+			Text:  c.Title,
+		}
+	}
+	return WriteWebVTT(w, cues)
+}
+
+// Returns the media playlist for the WebVTT chapters track, which plays it as
+// a single segment covering the whole video.
+func ChaptersPlaylist(duration float64) string {
+	return CaptionPlaylist([]CaptionSegment{{Name: ChaptersTrackName, Duration: secondsToDuration(duration)}})
+}
+
+// Writes the chapters as the JSON document referenced from the master playlist's
+// session data, with start and end times in seconds.
+func WriteChaptersJSON(w io.Writer, chapters []database.Chapter, duration float64) error {
+	type chapter struct {
+		Start float64 `json:"start"`
+		End   float64 `json:"end"`
+		Title string  `json:"title"`
+	}
+
+	doc := struct {
+		Chapters []chapter `json:"chapters"`
+	}{Chapters: make([]chapter, len(chapters))}
+	for i, c := range chapters {
+		doc.Chapters[i] = chapter{Start: c.Start, End: chapterEnd(chapters, i, duration), Title: c.Title}
+	}
+	return json.NewEncoder(w).Encode(doc)
+}
+
+// Returns when the i'th chapter ends, which is when the next one starts, or the
+// end of the video for the last.
+func chapterEnd(chapters []database.Chapter, i int, duration float64) float64 {
+	end := duration
+	if i+1 < len(chapters) {
+		end = chapters[i+1].Start
+	}
+	return max(end, chapters[i].Start)
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+}
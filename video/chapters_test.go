@@ -0,0 +1,53 @@
+package video
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/dantdj/goreel/database"
+)
+
+func TestDetectChapters(t *testing.T) {
+	scores := []frameScore{
+		{Time: 10, Score: 0.9},  // Too close to the start
+		{Time: 70, Score: 0.5},  // New chapter
+		{Time: 90, Score: 0.8},  // Too close to the previous chapter
+		{Time: 150, Score: 0.2}, // Below the threshold
+		{Time: 200, Score: 0.9}, // New chapter
+		{Time: 280, Score: 0.9}, // Too close to the end
+	}
+
+	starts := detectChapters(scores, 0.4, 60, 300)
+	if expected := []float64{0, 70, 200}; !slices.Equal(starts, expected) {
+		t.Errorf("expected %v, got %v", expected, starts)
+	}
+}
+
+func TestWriteChaptersWebVTT(t *testing.T) {
+	chapters := []database.Chapter{{Start: 0, Title: "Intro"}, {Start: 75.5, Title: "Main"}}
+
+	var buf bytes.Buffer
+	if err := WriteChaptersWebVTT(&buf, chapters, 120); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "WEBVTT\n\n00:00:00.000 --> 00:01:15.500\nIntro\n\n00:01:15.500 --> 00:02:00.000\nMain\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestWriteChaptersJSON(t *testing.T) {
+	chapters := []database.Chapter{{Start: 0, Title: "Intro"}, {Start: 75.5, Title: "Main"}}
+
+	var buf bytes.Buffer
+	if err := WriteChaptersJSON(&buf, chapters, 120); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `{"chapters":[{"start":0,"end":75.5,"title":"Intro"},{"start":75.5,"end":120,"title":"Main"}]}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,160 @@
+package video
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+)
+
+// How close a cut point needs to be to a keyframe to count as aligned with it.
+const keyframeTolerance = 0.001
+
+// Cuts a clip video's media out of its source video, then runs the clip through
+// the normal processing pipeline.
+func (p *Processor) Clip(ctx context.Context, videoId string) error {
+	logger := logging.FromContext(ctx)
+
+	if err := p.cutClip(ctx, videoId); err != nil {
+		if ctx.Err() != nil || errors.Is(err, database.ErrNotFound) {
+			return err
+		}
+		if statusErr := p.DB.SetVideoStatus(ctx, videoId, database.VideoStatusFailed); statusErr != nil {
+			logger.Error("Failed to mark video as failed", slog.String("video_id", videoId), slog.String("error", statusErr.Error()))
+		}
+		return err
+	}
+
+	return p.Process(ctx, videoId)
+}
+
+func (p *Processor) cutClip(ctx context.Context, videoId string) error {
+	logger := logging.FromContext(ctx)
+
+	v, err := p.DB.GetVideo(ctx, videoId)
+	if err != nil {
+		return fmt.Errorf("failed to get video: %w", err)
+	}
+	if v.SourceVideoID == nil || v.ClipStart == nil || v.ClipEnd == nil {
+		return fmt.Errorf("video %s is not a clip", videoId)
+	}
+	sourceId, start, end := *v.SourceVideoID, *v.ClipStart, *v.ClipEnd
+
+	logger.Info("Starting clip",
+		slog.String("video_id", videoId),
+		slog.String("source_video_id", sourceId),
+		slog.Float64("start", start),
+		slog.Float64("end", end))
+
+	baseDir := filepath.Join(p.TempDir, videoId+"-clip")
+	inputDir := filepath.Join(baseDir, "input")
+	inputPath := filepath.Join(inputDir, sourceId)
+	outputPath := filepath.Join(baseDir, videoId+".mkv")
+
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return fmt.Errorf("failed to make temp directory %s: %w", baseDir, err)
+	}
+	defer p.cleanup(ctx, baseDir)
+
+	if err := p.downloadVideo(sourceId, inputDir); err != nil {
+		return err
+	}
+
+	startTime, duration, err := probeTiming(ctx, inputPath)
+	if err != nil {
+		return err
+	}
+	if end > duration+keyframeTolerance {
+		return fmt.Errorf("clip end %.3fs is past the end of the source (%.3fs)", end, duration)
+	}
+
+	keyframes, err := probeKeyframes(ctx, inputPath)
+	if err != nil {
+		return err
+	}
+	streamCopy := isKeyframeAligned(keyframes, startTime, start, end, duration)
+
+	args := clipArgs(inputPath, outputPath, start, end, streamCopy)
+	logger.Info("Running FFmpeg clip with args", slog.String("args", fmt.Sprintf("%v", args)), slog.Bool("stream_copy", streamCopy))
+
+	output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	observeExit("ffmpeg", err)
+	if err != nil {
+		logger.Error("FFmpeg failed", slog.String("output", string(output)), slog.String("error", err.Error()))
+		return fmt.Errorf("FFmpeg failed: %w", err)
+	}
+
+	if err := p.checkNotDeleted(ctx, videoId); err != nil {
+		return err
+	}
+
+	// The clip is stored under its own ID, exactly as if it had been uploaded
+	file, err := os.Open(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if p.Storage.Upload(file, videoId) == "" {
+		return fmt.Errorf("failed to upload clip")
+	}
+	if err := p.removeIfDeleted(ctx, videoId); err != nil {
+		return err
+	}
+
+	logger.Info("Clip cut from source", slog.String("video_id", videoId), slog.String("source_video_id", sourceId))
+	return nil
+}
+
+// Reports whether both cut points land on keyframes, in which case the clip can be
+// stream copied without any decoding. The end of the source always counts as aligned.
+// Keyframe times are absolute, so are offset by the container's start time.
+func isKeyframeAligned(keyframes []float64, startTime, start, end, duration float64) bool {
+	onKeyframe := func(t float64) bool {
+		for _, k := range keyframes {
+			if math.Abs(k-startTime-t) <= keyframeTolerance {
+				return true
+			}
+		}
+		return false
+	}
+
+	return onKeyframe(start) && (onKeyframe(end) || math.Abs(end-duration) <= keyframeTolerance)
+}
+
+// Builds the FFmpeg arguments to cut [start, end) from the input. The output is
+// Matroska, as it can hold whatever codecs the source used.
+func clipArgs(inputPath, outputPath string, start, end float64, streamCopy bool) []string {
+	var args = []string{
+		"-ss", strconv.FormatFloat(start, 'f', 3, 64), // Seek before opening the input, which is exact when re-encoding
+		"-i", inputPath, // Input file
+		"-t", strconv.FormatFloat(end-start, 'f', 3, 64), // Clip length
+		"-map", "0:v:0", // First video stream
+		"-map", "0:a:0?", // First audio stream, if there is one
+	}
+
+	if streamCopy {
+		args = append(args,
+			"-codec", "copy", // Keep the original streams untouched
+			"-avoid_negative_ts", "make_zero", // Restart timestamps at zero
+		)
+	} else {
+		args = append(args,
+			"-codec:v", "h264", // Video codec
+			"-preset", "veryfast", // Encoding preset (balance speed/quality)
+			"-crf", "18", // Near-lossless, as this is re-encoded again by the pipeline
+			"-codec:a", "aac", // Audio codec
+			"-b:a", "192k", // Audio bitrate
+		)
+	}
+
+	return append(args, "-f", "matroska", "-y", outputPath)
+}
@@ -0,0 +1,47 @@
+package video
+
+import (
+	"testing"
+)
+
+func TestIsKeyframeAligned(t *testing.T) {
+	keyframes := []float64{1.4, 3.4, 5.4, 7.4}
+
+	tests := []struct {
+		name       string
+		start, end float64
+		expected   bool
+	}{
+		{"both on keyframes", 2, 4, true},
+		{"end of source", 4, 10, true},
+		{"start between keyframes", 2.5, 4, false},
+		{"end between keyframes", 2, 5, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Keyframes are offset by the 1.4s container start time
+			if got := isKeyframeAligned(keyframes, 1.4, tt.start, tt.end, 10); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseKeyframes(t *testing.T) {
+	output := "0.000000,K__\n0.033367,___\nN/A,K__\n2.002000,K_\n"
+	keyframes := parseKeyframes(output)
+	if len(keyframes) != 2 || keyframes[0] != 0 || keyframes[1] != 2.002 {
+		t.Errorf("unexpected keyframes: %v", keyframes)
+	}
+}
+
+func TestParseJob_LegacyMessage(t *testing.T) {
+	job, err := ParseJob([]byte("abc123XYZ0"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if job.Type != JobTypeProcess || job.VideoID != "abc123XYZ0" {
+		t.Errorf("unexpected job: %+v", job)
+	}
+}
@@ -0,0 +1,83 @@
+package video
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+	"github.com/dantdj/goreel/storage"
+)
+
+// Removes everything belonging to a video flagged for deletion: its source upload,
+// renditions, captions, thumbnails and database records. Each step skips anything
+// already gone, so an interrupted delete can simply be run again.
+func (p *Processor) Delete(ctx context.Context, videoId string) error {
+	logger := logging.FromContext(ctx)
+
+	logger.Info("Starting video deletion", slog.String("video_id", videoId))
+
+	count, err := p.deleteFiles(videoId)
+	if err != nil {
+		return err
+	}
+
+	if err := p.DB.DeleteVideo(ctx, videoId); err != nil {
+		return err
+	}
+
+	// A process or clip job part way through uploading when the video was
+	// flagged may have added files since the first sweep
+	more, err := p.deleteFiles(videoId)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Video deletion complete", slog.String("video_id", videoId), slog.Int("files", count+more))
+	return nil
+}
+
+// Deletes every file stored for a video, returning how many were listed.
+func (p *Processor) deleteFiles(videoId string) (int, error) {
+	names, err := p.Storage.List(videoId + "/")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list video files: %w", err)
+	}
+
+	// The source upload is stored under the bare ID, outside the video's prefix
+	for _, name := range append(names, videoId) {
+		if err := p.Storage.Delete(name); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return 0, fmt.Errorf("failed to delete %s: %w", name, err)
+		}
+	}
+	return len(names) + 1, nil
+}
+
+// Returns an error wrapping database.ErrNotFound if the video has been flagged
+// for deletion or is already gone, so jobs can stop before writing anything
+// more for it.
+func (p *Processor) checkNotDeleted(ctx context.Context, videoId string) error {
+	_, err := p.DB.GetVideo(ctx, videoId)
+	if errors.Is(err, database.ErrNotFound) {
+		return fmt.Errorf("video %s is being deleted: %w", videoId, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check video: %w", err)
+	}
+	return nil
+}
+
+// Checks the video hasn't been flagged for deletion after a job has uploaded
+// files for it. If it has, the delete may already have swept its files, so the
+// ones just uploaded are removed here instead.
+func (p *Processor) removeIfDeleted(ctx context.Context, videoId string) error {
+	err := p.checkNotDeleted(ctx, videoId)
+	if errors.Is(err, database.ErrNotFound) {
+		if _, cleanupErr := p.deleteFiles(videoId); cleanupErr != nil {
+			logging.FromContext(ctx).Error("Failed to remove files of deleted video", slog.String("video_id", videoId), slog.String("error", cleanupErr.Error()))
+		}
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+package video
+
+import (
+	"context"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dantdj/goreel/storage"
+)
+
+// Keeps blob names in memory, which is all deletes look at.
+type memoryStorage struct {
+	blobs map[string]bool
+}
+
+func (m *memoryStorage) Upload(fileReader io.Reader, name string) string {
+	m.blobs[name] = true
+	return name
+}
+
+func (m *memoryStorage) Retrieve(blobName string) (io.ReadCloser, int64, string) {
+	return nil, 0, ""
+}
+
+func (m *memoryStorage) Delete(blobName string) error {
+	if !m.blobs[blobName] {
+		return storage.ErrNotFound
+	}
+	delete(m.blobs, blobName)
+	return nil
+}
+
+func (m *memoryStorage) List(prefix string) ([]string, error) {
+	var names []string
+	for name := range m.blobs {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (m *memoryStorage) Ping(ctx context.Context) error { return nil }
+
+func TestDeleteFiles(t *testing.T) {
+	s := &memoryStorage{blobs: map[string]bool{
+		"abc/playlist.m3u8":    true,
+		"abc/segment_000.ts":   true,
+		"abcdef/playlist.m3u8": true,
+	}}
+	p := &Processor{Storage: s}
+
+	// The source upload is already gone, which isn't an error
+	count, err := p.deleteFiles("abc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 files, got %d", count)
+	}
+	if remaining := slices.Collect(maps.Keys(s.blobs)); !slices.Equal(remaining, []string{"abcdef/playlist.m3u8"}) {
+		t.Errorf("expected only the other video's files to remain, got %v", remaining)
+	}
+}
@@ -0,0 +1,133 @@
+package video
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var watermarkPositions = []string{"top-left", "top-right", "bottom-left", "bottom-right", "center"}
+
+// Label of the final video output in the filter graph built by videoFilterGraph.
+const filterOutputLabel = "[v]"
+
+// Builds the filter graph for a video rendition. The source is input 0, and if
+// the profile has a watermark then the watermark image is input 1. The source
+// is deinterlaced, rotated upright and given square pixels before it's sized,
+// so the rendition should be run with autorotation turned off.
+func videoFilterGraph(profile Profile, info streamInfo) string {
+	chain := strings.Join(append(normalizeFilters(info), sizeFilters(profile)...), ",")
+
+	if profile.Watermark.Image == "" {
+		return "[0:v]" + chain + filterOutputLabel
+	}
+
+	return strings.Join([]string{
+		"[0:v]" + chain + "[base]",
+		"[1:v]" + watermarkFilter(profile.Watermark, profile.Height) + "[wm]",
+		"[base][wm]" + overlayFilter(profile.Watermark) + filterOutputLabel,
+	}, ";")
+}
+
+// Filters that undo the quirks of the source, based on its probe data.
+func normalizeFilters(info streamInfo) []string {
+	var filters []string
+
+	if info.interlaced() {
+		// Outputs one frame per frame, and picks up the field order from the stream
+		filters = append(filters, "bwdif=mode=send_frame:parity=auto:deint=all")
+	}
+
+	switch info.Rotation {
+	case 90:
+		filters = append(filters, "transpose=clock")
+	case 180:
+		filters = append(filters, "hflip", "vflip")
+	case 270:
+		filters = append(filters, "transpose=cclock")
+	}
+
+	if info.SARNum != info.SARDen {
+		// Stretch the width so each pixel is square, keeping it even for the encoder
+		filters = append(filters, "scale=trunc(iw*sar/2)*2:ih", "setsar=1")
+	}
+
+	return filters
+}
+
+// Filters that size the upright, square-pixel video for the profile, letterboxing
+// or pillarboxing to the profile's aspect ratio if it has one.
+func sizeFilters(profile Profile) []string {
+	aspect, _ := parseAspectRatio(profile.AspectRatio)
+	if aspect == 0 {
+		// Scale to the profile height, maintain aspect ratio
+		return []string{fmt.Sprintf("scale=-2:%d", profile.Height)}
+	}
+
+	width := evenWidth(profile.Height, aspect)
+	return []string{
+		fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease:force_divisible_by=2", width, profile.Height),
+		fmt.Sprintf("pad=%d:%d:(ow-iw)/2:(oh-ih)/2", width, profile.Height),
+		"setsar=1",
+	}
+}
+
+// Works out the width of the rendition the filter graph will produce, or 0 if
+// the source's dimensions are unknown.
+func outputWidth(profile Profile, info streamInfo) int {
+	if aspect, _ := parseAspectRatio(profile.AspectRatio); aspect > 0 {
+		return evenWidth(profile.Height, aspect)
+	}
+	if aspect := info.displayAspect(); aspect > 0 {
+		return evenWidth(profile.Height, aspect)
+	}
+	return 0
+}
+
+func evenWidth(height int, aspect float64) int {
+	return int(math.Round(float64(height)*aspect/2)) * 2
+}
+
+// Parses an aspect ratio such as "16:9". An empty string gives 0 without an error.
+func parseAspectRatio(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	w, h, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, fmt.Errorf("aspect ratio must be in the form W:H")
+	}
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if errW != nil || errH != nil || width <= 0 || height <= 0 {
+		return 0, fmt.Errorf("aspect ratio must be in the form W:H")
+	}
+	return float64(width) / float64(height), nil
+}
+
+// Scales the watermark relative to the output height and applies its opacity.
+func watermarkFilter(w WatermarkSettings, videoHeight int) string {
+	height := max(int(float64(videoHeight)*w.Scale), 1)
+	return fmt.Sprintf("scale=-1:%d,format=rgba,colorchannelmixer=aa=%g", height, w.Opacity)
+}
+
+// Positions the watermark on the video, where W/H are the video's dimensions
+// and w/h are the watermark's.
+func overlayFilter(w WatermarkSettings) string {
+	m := w.Margin
+	var x, y string
+	switch w.Position {
+	case "top-left":
+		x, y = fmt.Sprint(m), fmt.Sprint(m)
+	case "top-right":
+		x, y = fmt.Sprintf("W-w-%d", m), fmt.Sprint(m)
+	case "bottom-left":
+		x, y = fmt.Sprint(m), fmt.Sprintf("H-h-%d", m)
+	case "center":
+		x, y = "(W-w)/2", "(H-h)/2"
+	default:
+		x, y = fmt.Sprintf("W-w-%d", m), fmt.Sprintf("H-h-%d", m)
+	}
+	return fmt.Sprintf("overlay=x=%s:y=%s", x, y)
+}
@@ -0,0 +1,58 @@
+package video
+
+import (
+	"testing"
+)
+
+var squareProgressive = streamInfo{Width: 1920, Height: 1080, SARNum: 1, SARDen: 1, FieldOrder: "progressive"}
+
+func TestVideoFilterGraph_NoWatermark(t *testing.T) {
+	if got := videoFilterGraph(defaultProfile, squareProgressive); got != "[0:v]scale=-2:720[v]" {
+		t.Errorf("unexpected filter graph: %s", got)
+	}
+}
+
+func TestVideoFilterGraph_Watermark(t *testing.T) {
+	profile := defaultProfile
+	profile.Watermark = WatermarkSettings{Image: "logo.png", Position: "top-right", Scale: 0.15, Opacity: 0.5, Margin: 20}
+
+	expected := "[0:v]scale=-2:720[base];" +
+		"[1:v]scale=-1:108,format=rgba,colorchannelmixer=aa=0.5[wm];" +
+		"[base][wm]overlay=x=W-w-20:y=20[v]"
+	if got := videoFilterGraph(profile, squareProgressive); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestVideoFilterGraph_Normalization(t *testing.T) {
+	// Anamorphic, interlaced and shot in portrait
+	info := streamInfo{Width: 720, Height: 576, SARNum: 64, SARDen: 45, FieldOrder: "tt", Rotation: 90}
+	profile := defaultProfile
+	profile.AspectRatio = "16:9"
+
+	expected := "[0:v]bwdif=mode=send_frame:parity=auto:deint=all,transpose=clock," +
+		"scale=trunc(iw*sar/2)*2:ih,setsar=1," +
+		"scale=1280:720:force_original_aspect_ratio=decrease:force_divisible_by=2," +
+		"pad=1280:720:(ow-iw)/2:(oh-ih)/2,setsar=1[v]"
+	if got := videoFilterGraph(profile, info); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestParseStreamInfo(t *testing.T) {
+	output := `{"streams": [{
+		"width": 1920, "height": 1080, "sample_aspect_ratio": "1:1", "field_order": "progressive",
+		"side_data_list": [{"rotation": -90}]
+	}]}`
+
+	info, err := parseStreamInfo([]byte(output))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Rotation != 90 {
+		t.Errorf("expected rotation of 90, got %d", info.Rotation)
+	}
+	if width := outputWidth(defaultProfile, info); width != 406 {
+		t.Errorf("expected portrait width of 406, got %d", width)
+	}
+}
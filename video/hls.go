@@ -0,0 +1,214 @@
+package video
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dantdj/goreel/database"
+)
+
+const (
+	subtitleGroupID = "subs"
+	audioGroupID    = "audio"
+	chaptersDataID  = "com.goreel.chapters"
+
+	// Name of the WebVTT chapters track served alongside the master playlist
+	ChaptersTrackName = "chapters.vtt"
+	// Name of the media playlist wrapping the WebVTT chapters track
+	ChaptersPlaylistName = "chapters.m3u8"
+	// Name of the JSON chapters document the master playlist's session data points to
+	ChaptersDataName = "chapters.json"
+)
+
+// Variant is a single video rendition listed in a master playlist.
+type Variant struct {
+	URI       string
+	Bandwidth int
+	Width     int
+	Height    int
+	Codecs    string
+}
+
+// SubtitleTrack is a caption track listed in a master playlist.
+type SubtitleTrack struct {
+	Name     string
+	Language string
+	Default  bool
+	URI      string
+}
+
+// AudioTrack is an audio-only rendition listed in a master playlist. Each one is
+// also offered as its own variant, so players can drop to audio-only when
+// bandwidth is too low for any of the video variants.
+type AudioTrack struct {
+	Name      string
+	Language  string
+	Default   bool
+	URI       string
+	Bandwidth int
+	Codecs    string
+}
+
+// MasterPlaylist describes the top-level HLS playlist for a video, tying the
+// variant streams together with any alternate renditions such as subtitles.
+type MasterPlaylist struct {
+	Variants  []Variant
+	Audio     []AudioTrack
+	Subtitles []SubtitleTrack
+	// URI of the JSON chapters document, if the video has chapters. Session
+	// data URIs must point to JSON, so this can't be the WebVTT track.
+	Chapters string
+	// URI of the media playlist for the WebVTT chapters track, listed as a
+	// subtitles rendition marked with the chapters characteristic.
+	ChaptersTrack string
+}
+
+func (m MasterPlaylist) String() string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:3\n")
+
+	if m.Chapters != "" {
+		fmt.Fprintf(&b, "#EXT-X-SESSION-DATA:DATA-ID=%q,URI=%q\n", chaptersDataID, m.Chapters)
+	}
+
+	for _, s := range m.Subtitles {
+		fmt.Fprintf(&b, "#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=%q,NAME=%q,LANGUAGE=%q,DEFAULT=%s,AUTOSELECT=YES,URI=%q\n",
+			subtitleGroupID, s.Name, s.Language, yesNo(s.Default), s.URI)
+	}
+
+	if m.ChaptersTrack != "" {
+		fmt.Fprintf(&b, "#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=%q,NAME=\"Chapters\",DEFAULT=NO,AUTOSELECT=NO,CHARACTERISTICS=%q,URI=%q\n",
+			subtitleGroupID, chaptersDataID, m.ChaptersTrack)
+	}
+
+	for _, a := range m.Audio {
+		attrs := []string{"TYPE=AUDIO", fmt.Sprintf("GROUP-ID=%q", audioGroupID), fmt.Sprintf("NAME=%q", a.Name)}
+		if a.Language != "" {
+			attrs = append(attrs, fmt.Sprintf("LANGUAGE=%q", a.Language))
+		}
+		attrs = append(attrs, "DEFAULT="+yesNo(a.Default), "AUTOSELECT=YES", fmt.Sprintf("URI=%q", a.URI))
+		fmt.Fprintf(&b, "#EXT-X-MEDIA:%s\n", strings.Join(attrs, ","))
+	}
+
+	for _, v := range m.Variants {
+		attrs := []string{fmt.Sprintf("BANDWIDTH=%d", v.Bandwidth)}
+		if v.Width > 0 && v.Height > 0 {
+			attrs = append(attrs, fmt.Sprintf("RESOLUTION=%dx%d", v.Width, v.Height))
+		}
+		if v.Codecs != "" {
+			attrs = append(attrs, fmt.Sprintf("CODECS=%q", v.Codecs))
+		}
+		if len(m.Subtitles) > 0 || m.ChaptersTrack != "" {
+			attrs = append(attrs, fmt.Sprintf("SUBTITLES=%q", subtitleGroupID))
+		}
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:%s\n%s\n", strings.Join(attrs, ","), v.URI)
+	}
+
+	for _, a := range m.Audio {
+		attrs := []string{fmt.Sprintf("BANDWIDTH=%d", a.Bandwidth)}
+		// No AUDIO attribute, as the variant is the audio rather than video it accompanies
+		if a.Codecs != "" {
+			attrs = append(attrs, fmt.Sprintf("CODECS=%q", a.Codecs))
+		}
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:%s\n%s\n", strings.Join(attrs, ","), a.URI)
+	}
+
+	return b.String()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "YES"
+	}
+	return "NO"
+}
+
+// Builds the master playlist for a processed video from its recorded
+// renditions and caption tracks.
+func (p *Processor) MasterPlaylist(ctx context.Context, videoId string) (MasterPlaylist, error) {
+	var m MasterPlaylist
+
+	renditions, err := p.DB.ListRenditions(ctx, videoId)
+	if err != nil {
+		return m, err
+	}
+	for _, r := range renditions {
+		if r.Kind == database.RenditionKindAudio {
+			m.Audio = append(m.Audio, AudioTrack{
+				Name:      "Audio only",
+				Default:   true,
+				URI:       r.Playlist,
+				Bandwidth: r.Bandwidth,
+				Codecs:    r.Codecs,
+			})
+			continue
+		}
+		m.Variants = append(m.Variants, Variant{
+			URI:       r.Playlist,
+			Bandwidth: r.Bandwidth,
+			Width:     r.Width,
+			Height:    r.Height,
+			Codecs:    r.Codecs,
+		})
+	}
+
+	captions, err := p.DB.ListCaptions(ctx, videoId)
+	if err != nil {
+		return m, err
+	}
+	for _, c := range captions {
+		m.Subtitles = append(m.Subtitles, SubtitleTrack{
+			Name:     c.Label,
+			Language: c.Language,
+			Default:  c.IsDefault,
+			URI:      CaptionPlaylistPath(c.Language),
+		})
+	}
+
+	chapters, err := p.DB.ListChapters(ctx, videoId)
+	if err != nil {
+		return m, err
+	}
+	if len(chapters) > 0 {
+		m.Chapters = ChaptersDataName
+		m.ChaptersTrack = ChaptersPlaylistName
+	}
+
+	return m, nil
+}
+
+var playlistURIAttrRX = regexp.MustCompile(`URI="([^"]*)"`)
+
+// Appends a query string to every URI in a playlist, both on URI lines and in
+// URI attributes of tags, so requests for the files it lists carry the query too.
+func AppendPlaylistQuery(playlist, query string) string {
+	if query == "" {
+		return playlist
+	}
+
+	appendQuery := func(uri string) string {
+		if strings.Contains(uri, "?") {
+			return uri + "&" + query
+		}
+		return uri + "?" + query
+	}
+
+	lines := strings.Split(playlist, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "#"):
+			lines[i] = playlistURIAttrRX.ReplaceAllStringFunc(line, func(attr string) string {
+				uri := playlistURIAttrRX.FindStringSubmatch(attr)[1]
+				return fmt.Sprintf("URI=%q", appendQuery(uri))
+			})
+		default:
+			lines[i] = appendQuery(trimmed)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
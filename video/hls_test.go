@@ -0,0 +1,111 @@
+package video
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMasterPlaylist_String(t *testing.T) {
+	m := MasterPlaylist{
+		Variants:  []Variant{{URI: "playlist.m3u8", Bandwidth: 1328000, Width: 1280, Height: 720, Codecs: "avc1.64001F,mp4a.40.2"}},
+		Audio:     []AudioTrack{{Name: "Audio only", Default: true, URI: "audio/playlist.m3u8", Bandwidth: 64000, Codecs: "mp4a.40.2"}},
+		Subtitles: []SubtitleTrack{{Name: "English", Language: "en", Default: true, URI: "captions/en/captions.m3u8"}},
+	}
+
+	expected := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",LANGUAGE="en",DEFAULT=YES,AUTOSELECT=YES,URI="captions/en/captions.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="Audio only",DEFAULT=YES,AUTOSELECT=YES,URI="audio/playlist.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1328000,RESOLUTION=1280x720,CODECS="avc1.64001F,mp4a.40.2",SUBTITLES="subs"
+playlist.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=64000,CODECS="mp4a.40.2"
+audio/playlist.m3u8
+`
+	if got := m.String(); got != expected {
+		t.Errorf("unexpected playlist:\n%s", got)
+	}
+}
+
+func TestMasterPlaylist_Chapters(t *testing.T) {
+	m := MasterPlaylist{
+		Variants:      []Variant{{URI: "playlist.m3u8", Bandwidth: 1328000}},
+		Chapters:      ChaptersDataName,
+		ChaptersTrack: ChaptersPlaylistName,
+	}
+
+	expected := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-SESSION-DATA:DATA-ID="com.goreel.chapters",URI="chapters.json"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Chapters",DEFAULT=NO,AUTOSELECT=NO,CHARACTERISTICS="com.goreel.chapters",URI="chapters.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1328000,SUBTITLES="subs"
+playlist.m3u8
+`
+	if got := m.String(); got != expected {
+		t.Errorf("unexpected playlist:\n%s", got)
+	}
+}
+
+func TestChaptersPlaylist(t *testing.T) {
+	expected := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:91
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXTINF:90.500,
+chapters.vtt
+#EXT-X-ENDLIST
+`
+	if got := ChaptersPlaylist(90.5); got != expected {
+		t.Errorf("unexpected playlist:\n%s", got)
+	}
+}
+
+func TestAppendPlaylistQuery(t *testing.T) {
+	playlist := strings.Join([]string{
+		"#EXTM3U",
+		`#EXT-X-SESSION-DATA:DATA-ID="com.goreel.chapters",URI="chapters.json"`,
+		`#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",URI="captions/en/captions.m3u8"`,
+		"#EXT-X-STREAM-INF:BANDWIDTH=1000",
+		"720p/playlist.m3u8",
+		"#EXTINF:6.0,",
+		"segment_000.ts?v=1",
+		"",
+	}, "\n")
+
+	want := strings.Join([]string{
+		"#EXTM3U",
+		`#EXT-X-SESSION-DATA:DATA-ID="com.goreel.chapters",URI="chapters.json?sig=x"`,
+		`#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",URI="captions/en/captions.m3u8?sig=x"`,
+		"#EXT-X-STREAM-INF:BANDWIDTH=1000",
+		"720p/playlist.m3u8?sig=x",
+		"#EXTINF:6.0,",
+		"segment_000.ts?v=1&sig=x",
+		"",
+	}, "\n")
+
+	if got := AppendPlaylistQuery(playlist, "sig=x"); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestParseCodecs(t *testing.T) {
+	output := `{"streams": [
+		{"codec_type": "video", "codec_name": "h264", "profile": "High", "level": 31},
+		{"codec_type": "audio", "codec_name": "aac", "profile": "LC"}
+	]}`
+	codecs, err := parseCodecs([]byte(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "avc1.64001F,mp4a.40.2"; codecs != expected {
+		t.Errorf("expected %q, got %q", expected, codecs)
+	}
+
+	codecs, err = parseCodecs([]byte(`{"streams": [{"codec_type": "video", "codec_name": "h264", "profile": "Main", "level": 40}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "avc1.4D4028"; codecs != expected {
+		t.Errorf("expected %q, got %q", expected, codecs)
+	}
+}
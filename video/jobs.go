@@ -0,0 +1,79 @@
+package video
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dantdj/goreel/metrics"
+	"github.com/dantdj/goreel/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Types of job handled by the processor.
+const (
+	JobTypeProcess = "process"
+	JobTypeClip    = "clip"
+	JobTypeDelete  = "delete"
+)
+
+// ErrUnknownJobType is returned when asked to run a job of a type the processor doesn't handle.
+var ErrUnknownJobType = errors.New("unknown job type")
+
+// Job is a unit of background work, sent to the processor as JSON over the queue.
+type Job struct {
+	Type    string `json:"type"`
+	VideoID string `json:"video_id"`
+	// ID of the request that queued the job, so its logs can be tied together
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Decodes a job from a queue message. Messages from before jobs were typed
+// are a bare video ID, and are treated as processing jobs.
+func ParseJob(message []byte) (Job, error) {
+	trimmed := strings.TrimSpace(string(message))
+	if !strings.HasPrefix(trimmed, "{") {
+		return Job{Type: JobTypeProcess, VideoID: trimmed}, nil
+	}
+
+	var job Job
+	if err := json.Unmarshal(message, &job); err != nil {
+		return Job{}, fmt.Errorf("invalid job message: %w", err)
+	}
+	if job.VideoID == "" {
+		return Job{}, fmt.Errorf("job is missing a video ID")
+	}
+	return job, nil
+}
+
+// Runs the given job to completion, in a span that's a child of any trace in ctx.
+func (p *Processor) RunJob(ctx context.Context, job Job) (err error) {
+	var run func(context.Context, string) error
+	switch job.Type {
+	case JobTypeProcess:
+		run = p.Process
+	case JobTypeClip:
+		run = p.Clip
+	case JobTypeDelete:
+		run = p.Delete
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownJobType, job.Type)
+	}
+
+	ctx, span := tracer.Start(ctx, "job "+job.Type, trace.WithAttributes(attribute.String("goreel.video_id", job.VideoID)))
+	defer func() { tracing.End(span, err) }()
+
+	inFlight := metrics.JobsInFlight.WithLabelValues(job.Type)
+	inFlight.Inc()
+	start := time.Now()
+	defer func() {
+		inFlight.Dec()
+		metrics.JobDuration.WithLabelValues(job.Type, metrics.Result(err)).Observe(time.Since(start).Seconds())
+	}()
+
+	return run(ctx, job.VideoID)
+}
@@ -0,0 +1,96 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/dantdj/goreel/logging"
+)
+
+// LoudnessMeasurement holds the values reported by the first loudnorm pass.
+type LoudnessMeasurement struct {
+	InputI       float64
+	InputTP      float64
+	InputLRA     float64
+	InputThresh  float64
+	TargetOffset float64
+}
+
+// Runs the analysis pass of FFmpeg's loudnorm filter over the input's audio.
+// Returns nil without an error if the input has no audio stream to measure.
+func measureLoudness(ctx context.Context, videoPath string, settings LoudnessSettings) (*LoudnessMeasurement, error) {
+	logger := logging.FromContext(ctx)
+
+	var args = []string{
+		"-hide_banner",
+		"-nostats",
+		"-i", videoPath, // Input file
+		"-map", "0:a:0?", // Measure the first audio stream, which is the one normalized
+		"-af", loudnormFilter(settings, nil) + ":print_format=json", // Analysis pass only
+		"-f", "null", "-", // Discard the output
+	}
+
+	logger.Info("Running FFmpeg loudness analysis with args", slog.String("args", fmt.Sprintf("%v", args)))
+
+	output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	observeExit("ffmpeg", err)
+	if err != nil {
+		if bytes.Contains(output, []byte("does not contain any stream")) {
+			return nil, nil
+		}
+		logger.Error("FFmpeg loudness analysis failed", slog.String("output", string(output)), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("FFmpeg loudness analysis failed: %w", err)
+	}
+
+	return parseLoudnormOutput(output)
+}
+
+// Pulls the JSON summary loudnorm prints at the end of its output.
+func parseLoudnormOutput(output []byte) (*LoudnessMeasurement, error) {
+	start := bytes.LastIndexByte(output, '{')
+	end := bytes.LastIndexByte(output, '}')
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("no loudnorm summary found in FFmpeg output")
+	}
+
+	// loudnorm reports every value as a string
+	var raw map[string]string
+	if err := json.Unmarshal(output[start:end+1], &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse loudnorm summary: %w", err)
+	}
+
+	var m LoudnessMeasurement
+	fields := map[string]*float64{
+		"input_i":       &m.InputI,
+		"input_tp":      &m.InputTP,
+		"input_lra":     &m.InputLRA,
+		"input_thresh":  &m.InputThresh,
+		"target_offset": &m.TargetOffset,
+	}
+	for key, dest := range fields {
+		value, err := strconv.ParseFloat(strings.TrimSpace(raw[key]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in loudnorm summary: %q", key, raw[key])
+		}
+		*dest = value
+	}
+
+	return &m, nil
+}
+
+// Builds the loudnorm filter for the given settings. When a measurement from the
+// first pass is provided, the filter applies linear normalization using it.
+func loudnormFilter(settings LoudnessSettings, m *LoudnessMeasurement) string {
+	filter := fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%g", settings.TargetLUFS, settings.TruePeak, settings.LRA)
+	if m != nil {
+		filter += fmt.Sprintf(":measured_I=%g:measured_TP=%g:measured_LRA=%g:measured_thresh=%g:offset=%g:linear=true",
+			m.InputI, m.InputTP, m.InputLRA, m.InputThresh, m.TargetOffset)
+	}
+	return filter
+}
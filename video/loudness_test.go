@@ -0,0 +1,46 @@
+package video
+
+import (
+	"testing"
+)
+
+const sampleLoudnormOutput = `[Parsed_loudnorm_0 @ 0x5581] 
+{
+	"input_i" : "-27.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "18.06",
+	"input_thresh" : "-39.20",
+	"output_i" : "-16.58",
+	"output_tp" : "-1.50",
+	"output_lra" : "14.78",
+	"output_thresh" : "-27.71",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.58"
+}
+`
+
+func TestParseLoudnormOutput(t *testing.T) {
+	m, err := parseLoudnormOutput([]byte(sampleLoudnormOutput))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.InputI != -27.61 || m.InputTP != -4.47 || m.TargetOffset != 0.58 {
+		t.Errorf("unexpected measurement: %+v", m)
+	}
+}
+
+func TestParseLoudnormOutput_Missing(t *testing.T) {
+	if _, err := parseLoudnormOutput([]byte("no summary here")); err == nil {
+		t.Error("expected an error when the summary is missing")
+	}
+}
+
+func TestLoudnormFilter_SecondPass(t *testing.T) {
+	settings := LoudnessSettings{Enabled: true, TargetLUFS: -16, TruePeak: -1.5, LRA: 11}
+	m := &LoudnessMeasurement{InputI: -27.61, InputTP: -4.47, InputLRA: 18.06, InputThresh: -39.2, TargetOffset: 0.58}
+
+	expected := "loudnorm=I=-16:TP=-1.5:LRA=11:measured_I=-27.61:measured_TP=-4.47:measured_LRA=18.06:measured_thresh=-39.2:offset=0.58:linear=true"
+	if got := loudnormFilter(settings, m); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
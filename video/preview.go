@@ -0,0 +1,169 @@
+package video
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dantdj/goreel/logging"
+)
+
+// Directory, relative to the video, holding its still and animated thumbnails.
+const thumbnailsDir = "thumbnails"
+
+// Scene change score for a single frame of the source.
+type frameScore struct {
+	Time  float64
+	Score float64
+}
+
+// Returns the preview's file name relative to the video, e.g. "thumbnails/preview.webp".
+func previewName(format string) string {
+	return thumbnailsDir + "/preview." + format
+}
+
+// Creates a short looping preview of the most active part of the video in
+// baseDir, returning its name relative to the video.
+func (p *Processor) generatePreview(ctx context.Context, profile Profile, info streamInfo, videoPath, baseDir string, scores []frameScore) (string, error) {
+	logger := logging.FromContext(ctx)
+
+	settings := profile.Preview
+	start := mostActiveWindow(scores, settings.Duration)
+
+	outputDir := filepath.Join(baseDir, thumbnailsDir)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to make thumbnails directory %s: %w", outputDir, err)
+	}
+
+	name := previewName(settings.Format)
+	outputPath := filepath.Join(baseDir, name)
+	args := previewArgs(settings, info, videoPath, outputPath, start)
+
+	logger.Info("Running FFmpeg preview with args", slog.String("args", fmt.Sprintf("%v", args)))
+
+	output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	observeExit("ffmpeg", err)
+	if err != nil {
+		logger.Error("FFmpeg failed", slog.String("output", string(output)), slog.String("error", err.Error()))
+		// Don't leave a partial preview behind to be uploaded with the segments
+		os.Remove(outputPath)
+		return "", fmt.Errorf("FFmpeg failed: %w", err)
+	}
+
+	return name, nil
+}
+
+// Scores every frame of the video by how different it is from the one before,
+// working on a heavily downscaled copy as only relative motion matters.
+func sceneScores(ctx context.Context, videoPath string) ([]frameScore, error) {
+	var args = []string{
+		"-hide_banner",
+		"-nostats",
+		"-i", videoPath, // Input file
+		"-an",                                                             // Ignore audio
+		"-vf", "scale=160:-2,select='gte(scene,0)',metadata=print:file=-", // Print the scene score of every frame
+		"-f", "null", "-", // Discard the output
+	}
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	output, err := cmd.Output()
+	observeExit("ffmpeg", err)
+	if err != nil {
+		logging.FromContext(ctx).Error("FFmpeg scene scoring failed", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("FFmpeg scene scoring failed: %w", err)
+	}
+
+	return parseSceneScores(string(output)), nil
+}
+
+// Parses the output of the metadata=print filter, which gives a frame line with
+// its timestamp followed by that frame's metadata lines.
+func parseSceneScores(output string) []frameScore {
+	var scores []frameScore
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "frame:") {
+			// Frames without a timestamp are skipped, along with their metadata
+			_, ptsTime, _ := strings.Cut(line, "pts_time:")
+			if fields := strings.Fields(ptsTime); len(fields) > 0 {
+				if t, err := strconv.ParseFloat(fields[0], 64); err == nil {
+					scores = append(scores, frameScore{Time: t})
+				}
+			}
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(line, "lavfi.scene_score="); ok && len(scores) > 0 {
+			if score, err := strconv.ParseFloat(value, 64); err == nil {
+				scores[len(scores)-1].Score = score
+			}
+		}
+	}
+
+	return scores
+}
+
+// Returns the start time of the window with the highest total scene score.
+// Falls back to the start of the video if it's shorter than the window.
+func mostActiveWindow(scores []frameScore, window float64) float64 {
+	var bestStart, bestTotal, total float64
+	tail := 0
+
+	for _, s := range scores {
+		total += s.Score
+		for s.Time-scores[tail].Time > window {
+			total -= scores[tail].Score
+			tail++
+		}
+
+		// Only consider windows that are fully inside the video
+		windowStart := s.Time - window
+		if windowStart < scores[0].Time {
+			continue
+		}
+		if total > bestTotal {
+			bestTotal = total
+			bestStart = max(windowStart, 0)
+		}
+	}
+
+	return bestStart
+}
+
+// Builds the FFmpeg arguments for an animated preview starting at start.
+func previewArgs(settings PreviewSettings, info streamInfo, videoPath, outputPath string, start float64) []string {
+	// Normalize the source the same way as the renditions, so the preview matches them
+	filters := append(normalizeFilters(info), fmt.Sprintf("fps=%d", settings.FPS), fmt.Sprintf("scale=%d:-2:flags=lanczos", settings.Width))
+	base := strings.Join(filters, ",")
+
+	var args = []string{
+		"-noautorotate",                               // Rotation is handled by the filters
+		"-ss", strconv.FormatFloat(start, 'f', 3, 64), // Start of the most active window
+		"-t", strconv.FormatFloat(settings.Duration, 'f', 3, 64), // Preview length
+		"-i", videoPath, // Input file
+		"-an",        // Previews are silent
+		"-loop", "0", // Loop forever
+	}
+
+	if settings.Format == "gif" {
+		// Generate a palette from the clip itself, as the default GIF palette looks terrible
+		args = append(args, "-filter_complex", base+",split[a][b];[a]palettegen[p];[b][p]paletteuse")
+	} else {
+		args = append(args,
+			"-vf", base,
+			"-codec:v", "libwebp", // Animated WebP
+			"-quality", "70", // Lossy quality
+		)
+	}
+
+	return append(args, "-y", outputPath)
+}
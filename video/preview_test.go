@@ -0,0 +1,51 @@
+package video
+
+import (
+	"testing"
+)
+
+func TestParseSceneScores(t *testing.T) {
+	output := `frame:0    pts:0       pts_time:0
+lavfi.scene_score=0.000000
+frame:1    pts:512     pts_time:0.04
+lavfi.scene_score=0.250000
+`
+	scores := parseSceneScores(output)
+	if len(scores) != 2 {
+		t.Fatalf("expected 2 scores, got %d", len(scores))
+	}
+	if scores[1].Time != 0.04 || scores[1].Score != 0.25 {
+		t.Errorf("unexpected score: %+v", scores[1])
+	}
+}
+
+func TestParseSceneScores_MissingTimestamp(t *testing.T) {
+	output := "frame:0    pts:0       pts_time:\nlavfi.scene_score=0.5\n"
+	if scores := parseSceneScores(output); len(scores) != 0 {
+		t.Errorf("expected no scores, got %+v", scores)
+	}
+}
+
+func TestMostActiveWindow(t *testing.T) {
+	var scores []frameScore
+	for i := range 100 {
+		score := 0.01
+		// A burst of activity between 6s and 7s
+		if i >= 60 && i < 70 {
+			score = 0.5
+		}
+		scores = append(scores, frameScore{Time: float64(i) / 10, Score: score})
+	}
+
+	start := mostActiveWindow(scores, 2)
+	if start < 4.9 || start > 6 {
+		t.Errorf("expected window covering the burst, got start %v", start)
+	}
+}
+
+func TestMostActiveWindow_ShortVideo(t *testing.T) {
+	scores := []frameScore{{Time: 0, Score: 0}, {Time: 1, Score: 0.9}}
+	if start := mostActiveWindow(scores, 3); start != 0 {
+		t.Errorf("expected start of video, got %v", start)
+	}
+}
@@ -0,0 +1,252 @@
+package video
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/dantdj/goreel/logging"
+)
+
+// Returns the container start time and duration of the file at videoPath, in seconds.
+func probeTiming(ctx context.Context, videoPath string) (start, duration float64, err error) {
+	var args = []string{
+		"-v", "error", // Only log errors
+		"-show_entries", "format=start_time,duration", // Container timing only
+		"-of", "default=noprint_wrappers=1", // One key=value per line
+		videoPath,
+	}
+
+	output, err := exec.CommandContext(ctx, "ffprobe", args...).Output()
+	observeExit("ffprobe", err)
+	if err != nil {
+		logging.FromContext(ctx).Error("FFprobe failed", slog.String("output", string(output)), slog.String("error", err.Error()))
+		return 0, 0, fmt.Errorf("FFprobe failed: %w", err)
+	}
+
+	for line := range strings.Lines(string(output)) {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+		n, parseErr := strconv.ParseFloat(value, 64)
+		switch {
+		case key == "start_time" && parseErr == nil:
+			start = n
+		case key == "duration" && parseErr == nil:
+			duration = n
+		case key == "duration":
+			return 0, 0, fmt.Errorf("invalid duration %q from FFprobe", value)
+		}
+	}
+	return start, duration, nil
+}
+
+// Returns the presentation times, in seconds, of every keyframe in the first
+// video stream. Reads packet flags only, so nothing needs decoding.
+func probeKeyframes(ctx context.Context, videoPath string) ([]float64, error) {
+	var args = []string{
+		"-v", "error", // Only log errors
+		"-select_streams", "v:0", // First video stream
+		"-show_entries", "packet=pts_time,flags", // Timestamp and keyframe flag per packet
+		"-of", "csv=p=0", // One "pts_time,flags" line per packet
+		videoPath,
+	}
+
+	output, err := exec.CommandContext(ctx, "ffprobe", args...).Output()
+	observeExit("ffprobe", err)
+	if err != nil {
+		logging.FromContext(ctx).Error("FFprobe failed", slog.String("output", string(output)), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("FFprobe failed: %w", err)
+	}
+
+	return parseKeyframes(string(output)), nil
+}
+
+func parseKeyframes(output string) []float64 {
+	var keyframes []float64
+	for line := range strings.Lines(output) {
+		ptsText, flags, ok := strings.Cut(strings.TrimSpace(line), ",")
+		if !ok || !strings.HasPrefix(flags, "K") {
+			continue
+		}
+		pts, err := strconv.ParseFloat(ptsText, 64)
+		if err != nil {
+			// Packets without a timestamp report "N/A"
+			continue
+		}
+		keyframes = append(keyframes, pts)
+	}
+	return keyframes
+}
+
+// Properties of the source's first video stream that affect how it's filtered.
+type streamInfo struct {
+	Width  int
+	Height int
+	// Sample (pixel) aspect ratio as numerator and denominator, 1:1 for square pixels
+	SARNum, SARDen int
+	// "progressive", "tt", "bb", "tb", "bt" or "unknown"
+	FieldOrder string
+	// Clockwise rotation, in degrees, needed to display the video upright
+	Rotation int
+}
+
+// Probes the first video stream for its dimensions, pixel shape, field order
+// and rotation.
+func probeStream(ctx context.Context, videoPath string) (streamInfo, error) {
+	var args = []string{
+		"-v", "error", // Only log errors
+		"-select_streams", "v:0", // First video stream
+		"-show_entries", "stream=width,height,sample_aspect_ratio,field_order:stream_tags=rotate:stream_side_data=rotation",
+		"-of", "json",
+		videoPath,
+	}
+
+	output, err := exec.CommandContext(ctx, "ffprobe", args...).Output()
+	observeExit("ffprobe", err)
+	if err != nil {
+		logging.FromContext(ctx).Error("FFprobe failed", slog.String("output", string(output)), slog.String("error", err.Error()))
+		return streamInfo{}, fmt.Errorf("FFprobe failed: %w", err)
+	}
+
+	return parseStreamInfo(output)
+}
+
+func parseStreamInfo(output []byte) (streamInfo, error) {
+	var probe struct {
+		Streams []struct {
+			Width             int    `json:"width"`
+			Height            int    `json:"height"`
+			SampleAspectRatio string `json:"sample_aspect_ratio"`
+			FieldOrder        string `json:"field_order"`
+			Tags              struct {
+				Rotate string `json:"rotate"`
+			} `json:"tags"`
+			SideDataList []struct {
+				Rotation *float64 `json:"rotation"`
+			} `json:"side_data_list"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return streamInfo{}, fmt.Errorf("failed to parse FFprobe output: %w", err)
+	}
+	if len(probe.Streams) == 0 {
+		return streamInfo{}, fmt.Errorf("no video stream found")
+	}
+	s := probe.Streams[0]
+
+	info := streamInfo{Width: s.Width, Height: s.Height, SARNum: 1, SARDen: 1, FieldOrder: s.FieldOrder}
+
+	// Unknown SARs are reported as 0:1, and are treated as square
+	if num, den, ok := strings.Cut(s.SampleAspectRatio, ":"); ok {
+		n, errN := strconv.Atoi(num)
+		d, errD := strconv.Atoi(den)
+		if errN == nil && errD == nil && n > 0 && d > 0 {
+			info.SARNum, info.SARDen = n, d
+		}
+	}
+
+	// The display matrix gives a counter-clockwise rotation, while the older
+	// rotate tag is already clockwise
+	for _, sd := range s.SideDataList {
+		if sd.Rotation != nil {
+			info.Rotation = normalizeRotation(-int(math.Round(*sd.Rotation)))
+		}
+	}
+	if info.Rotation == 0 && s.Tags.Rotate != "" {
+		if r, err := strconv.Atoi(s.Tags.Rotate); err == nil {
+			info.Rotation = normalizeRotation(r)
+		}
+	}
+
+	return info, nil
+}
+
+// Probes a transcoded segment for the RFC 6381 codecs string of its streams,
+// as listed in a master playlist's CODECS attribute.
+func probeCodecs(ctx context.Context, segmentPath string) (string, error) {
+	var args = []string{
+		"-v", "error", // Only log errors
+		"-show_entries", "stream=codec_type,codec_name,profile,level",
+		"-of", "json",
+		segmentPath,
+	}
+
+	output, err := exec.CommandContext(ctx, "ffprobe", args...).Output()
+	observeExit("ffprobe", err)
+	if err != nil {
+		logging.FromContext(ctx).Error("FFprobe failed", slog.String("output", string(output)), slog.String("error", err.Error()))
+		return "", fmt.Errorf("FFprobe failed: %w", err)
+	}
+
+	return parseCodecs(output)
+}
+
+// Profile IDC and constraint flags, in hex, of the H.264 profiles FFprobe names.
+var avcProfiles = map[string]string{
+	"Constrained Baseline": "42E0",
+	"Baseline":             "4200",
+	"Main":                 "4D40",
+	"High":                 "6400",
+}
+
+func parseCodecs(output []byte) (string, error) {
+	var probe struct {
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			CodecName string `json:"codec_name"`
+			Profile   string `json:"profile"`
+			Level     int    `json:"level"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return "", fmt.Errorf("failed to parse FFprobe output: %w", err)
+	}
+
+	var codecs []string
+	for _, s := range probe.Streams {
+		switch {
+		case s.CodecType == "video" && s.CodecName == "h264":
+			profile, ok := avcProfiles[s.Profile]
+			if !ok {
+				return "", fmt.Errorf("unsupported H.264 profile %q", s.Profile)
+			}
+			codecs = append(codecs, fmt.Sprintf("avc1.%s%02X", profile, s.Level))
+		case s.CodecType == "audio" && s.CodecName == "aac":
+			codecs = append(codecs, aacCodecs)
+		}
+	}
+	if len(codecs) == 0 {
+		return "", fmt.Errorf("no known codecs found")
+	}
+	return strings.Join(codecs, ","), nil
+}
+
+// Snaps a rotation to the nearest quarter turn in [0, 360).
+func normalizeRotation(degrees int) int {
+	quarter := int(math.Round(float64(degrees)/90)) * 90
+	return ((quarter % 360) + 360) % 360
+}
+
+func (s streamInfo) interlaced() bool {
+	switch s.FieldOrder {
+	case "tt", "bb", "tb", "bt":
+		return true
+	}
+	return false
+}
+
+// Returns the display aspect ratio once rotation and pixel shape are accounted for.
+func (s streamInfo) displayAspect() float64 {
+	if s.Width == 0 || s.Height == 0 {
+		return 0
+	}
+	aspect := float64(s.Width) * float64(s.SARNum) / (float64(s.Height) * float64(s.SARDen))
+	if s.Rotation == 90 || s.Rotation == 270 {
+		aspect = 1 / aspect
+	}
+	return aspect
+}
@@ -1,75 +1,271 @@
 package video
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log/slog"
+	"math"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"strconv"
+	"time"
 
+	"github.com/dantdj/goreel/database"
+	"github.com/dantdj/goreel/logging"
+	"github.com/dantdj/goreel/metrics"
 	"github.com/dantdj/goreel/storage"
+	"github.com/dantdj/goreel/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/dantdj/goreel/video")
+
+const (
+	hlsPlaylistName   = "playlist.m3u8"
+	watermarkFileName = "watermark"
 )
 
 type Processor struct {
-	Storage storage.Service
+	Storage  storage.Service
+	DB       *database.DB
+	Profiles map[string]Profile
+	// Videos are downloaded and transcoded under here
+	TempDir string
 }
 
-func NewProcessor(s storage.Service) *Processor {
+func NewProcessor(s storage.Service, db *database.DB, profiles map[string]Profile, tempDir string) *Processor {
 	return &Processor{
-		Storage: s,
+		Storage:  s,
+		DB:       db,
+		Profiles: profiles,
+		TempDir:  tempDir,
+	}
+}
+
+// Transcodes the uploaded video into HLS renditions, tracking the video's
+// status in the database as it goes.
+func (p *Processor) Process(ctx context.Context, videoId string) error {
+	logger := logging.FromContext(ctx)
+
+	if err := p.DB.SetVideoStatus(ctx, videoId, database.VideoStatusProcessing); err != nil {
+		return fmt.Errorf("failed to mark video as processing: %w", err)
+	}
+
+	if err := p.process(ctx, videoId); err != nil {
+		// Jobs interrupted by shutdown are retried, so the video stays processing,
+		// and deleted videos have no status left to set
+		if ctx.Err() != nil || errors.Is(err, database.ErrNotFound) {
+			return err
+		}
+		if statusErr := p.DB.SetVideoStatus(ctx, videoId, database.VideoStatusFailed); statusErr != nil {
+			logger.Error("Failed to mark video as failed", slog.String("video_id", videoId), slog.String("error", statusErr.Error()))
+		}
+		return err
 	}
+
+	return p.DB.SetVideoStatus(ctx, videoId, database.VideoStatusReady)
 }
 
-func (p *Processor) Process(videoId string) error {
-	slog.Info("Starting video processing", slog.String("video_id", videoId))
+func (p *Processor) process(ctx context.Context, videoId string) error {
+	logger := logging.FromContext(ctx)
+
+	logger.Info("Starting video processing", slog.String("video_id", videoId))
 
-	baseDir := filepath.Join(os.TempDir(), videoId)
+	v, err := p.DB.GetVideo(ctx, videoId)
+	if err != nil {
+		return fmt.Errorf("failed to get video: %w", err)
+	}
+	profile, ok := p.Profiles[v.Profile]
+	if !ok {
+		return fmt.Errorf("unknown encoding profile %q", v.Profile)
+	}
+
+	baseDir := filepath.Join(p.TempDir, videoId)
 	inputDir := filepath.Join(baseDir, "input")
 	inputPath := filepath.Join(inputDir, videoId)
 
 	if err := os.MkdirAll(baseDir, 0755); err != nil {
 		return fmt.Errorf("failed to make temp directory %s: %w", baseDir, err)
 	}
-	defer p.cleanup(baseDir)
+	defer p.cleanup(ctx, baseDir)
 
-	if err := p.downloadVideo(videoId, inputDir); err != nil {
+	_, span := tracer.Start(ctx, "download source")
+	err = p.downloadVideo(videoId, inputDir)
+	tracing.End(span, err)
+	if err != nil {
 		return err
 	}
-	slog.Info("Video downloaded to temp", slog.String("video_id", videoId))
+	logger.Info("Video downloaded to temp", slog.String("video_id", videoId))
+
+	_, duration, err := probeTiming(ctx, inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to probe video: %w", err)
+	}
+	info, err := probeStream(ctx, inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to probe video stream: %w", err)
+	}
+	logger.Info("Probed video stream",
+		slog.String("video_id", videoId),
+		slog.Int("width", info.Width),
+		slog.Int("height", info.Height),
+		slog.String("sar", fmt.Sprintf("%d:%d", info.SARNum, info.SARDen)),
+		slog.String("field_order", info.FieldOrder),
+		slog.Int("rotation", info.Rotation))
+	if err := p.DB.SetVideoDuration(ctx, videoId, duration); err != nil {
+		return fmt.Errorf("failed to record duration: %w", err)
+	}
+
+	if profile.Watermark.Image != "" {
+		if err := p.downloadWatermark(profile.Watermark.Image, inputDir); err != nil {
+			return err
+		}
+	}
+
+	var audioFilter string
+	if profile.Loudness.Enabled {
+		audioFilter, err = p.normalizeLoudness(ctx, videoId, inputPath, profile.Loudness)
+		if err != nil {
+			return fmt.Errorf("failed to measure loudness: %w", err)
+		}
+	}
 
 	// Transcode
-	if err := p.generateM3U8(videoId, inputPath, baseDir); err != nil {
+	transcodeStart := time.Now()
+	_, span = tracer.Start(ctx, "ffmpeg transcode", trace.WithAttributes(attribute.String("goreel.profile", profile.Name)))
+	err = p.generateM3U8(ctx, profile, info, inputPath, baseDir, audioFilter)
+	tracing.End(span, err)
+	if err != nil {
 		return fmt.Errorf("failed to generate M3U8 playlist: %w", err)
 	}
-	slog.Info("HLS generation complete", slog.String("video_id", videoId))
+	metrics.TranscodeDuration.WithLabelValues(profile.Name).Observe(time.Since(transcodeStart).Seconds())
+	logger.Info("HLS generation complete", slog.String("video_id", videoId))
+
+	// Players use the codecs to choose between variants before loading any of them
+	codecs, err := probeCodecs(ctx, filepath.Join(baseDir, "segment_000.ts"))
+	if err != nil {
+		return fmt.Errorf("failed to probe output codecs: %w", err)
+	}
+
+	renditions := []database.Rendition{{
+		Kind:      database.RenditionKindVideo,
+		Name:      profile.RenditionName(),
+		Playlist:  hlsPlaylistName,
+		Bandwidth: profile.Bandwidth(),
+		Width:     outputWidth(profile, info),
+		Height:    profile.Height,
+		Codecs:    codecs,
+	}}
+
+	var audioDownload string
+	if profile.AudioOnly.Enabled {
+		hasAudio, err := p.generateAudioOnly(ctx, profile, inputPath, baseDir, audioFilter)
+		if err != nil {
+			return fmt.Errorf("failed to generate audio-only outputs: %w", err)
+		}
+		if hasAudio {
+			renditions = append(renditions, database.Rendition{
+				Kind:      database.RenditionKindAudio,
+				Name:      audioRenditionName,
+				Playlist:  audioPlaylistPath(),
+				Bandwidth: profile.AudioOnly.Bitrate,
+				Codecs:    aacCodecs,
+			})
+			audioDownload = audioDownloadName(profile.AudioOnly.DownloadFormat)
+			logger.Info("Audio-only generation complete", slog.String("video_id", videoId))
+		} else {
+			logger.Info("No audio stream, skipping audio-only outputs", slog.String("video_id", videoId))
+		}
+	}
+
+	// Scene change scores drive both the preview and chapter detection
+	var scores []frameScore
+	if profile.Preview.Enabled || profile.Chapters.Enabled {
+		scores, err = sceneScores(ctx, inputPath)
+		if err != nil {
+			return fmt.Errorf("failed to score scene changes: %w", err)
+		}
+	}
+
+	// The preview is a nicety, so the video is still published without one,
+	// e.g. when FFmpeg was built without WebP support
+	var preview string
+	if profile.Preview.Enabled {
+		preview, err = p.generatePreview(ctx, profile, info, inputPath, baseDir, scores)
+		if err != nil {
+			logger.Error("Failed to generate preview, continuing without one", slog.String("video_id", videoId), slog.String("error", err.Error()))
+		} else {
+			logger.Info("Preview generation complete", slog.String("video_id", videoId))
+		}
+	}
 
 	playlistFiles, err := p.getFilePaths(baseDir)
 	if err != nil {
 		return fmt.Errorf("failed to get file paths: %w", err)
 	}
 
-	slog.Info("Uploading segments", slog.String("video_id", videoId), slog.Int("count", len(playlistFiles)))
+	if err := p.checkNotDeleted(ctx, videoId); err != nil {
+		return err
+	}
 
+	logger.Info("Uploading segments", slog.String("video_id", videoId), slog.Int("count", len(playlistFiles)))
+
+	_, span = tracer.Start(ctx, "upload segments", trace.WithAttributes(attribute.Int("goreel.file_count", len(playlistFiles))))
 	for _, path := range playlistFiles {
-		if err := p.uploadFile(path); err != nil {
-			return fmt.Errorf("failed to upload file %s: %w", path, err)
+		if err := p.uploadFile(videoId, baseDir, path); err != nil {
+			err = fmt.Errorf("failed to upload file %s: %w", path, err)
+			tracing.End(span, err)
+			return err
 		}
 	}
+	span.End()
 
-	// Delete the local files to avoid cluttering up the temp directory
-	if err := p.Storage.Delete(videoId); err != nil {
-		return fmt.Errorf("failed to delete video from storage: %w", err)
+	if err := p.removeIfDeleted(ctx, videoId); err != nil {
+		return err
 	}
 
-	slog.Info("Video processing complete", slog.String("video_id", videoId))
+	if err := p.DB.SetRenditions(ctx, videoId, renditions); err != nil {
+		return fmt.Errorf("failed to record renditions: %w", err)
+	}
+
+	if audioDownload != "" {
+		if err := p.DB.SetVideoAudioDownload(ctx, videoId, audioDownload); err != nil {
+			return fmt.Errorf("failed to record audio download: %w", err)
+		}
+	}
+
+	if preview != "" {
+		if err := p.DB.SetVideoPreview(ctx, videoId, preview); err != nil {
+			return fmt.Errorf("failed to record preview: %w", err)
+		}
+	}
+
+	if profile.Chapters.Enabled {
+		starts := detectChapters(scores, profile.Chapters.Threshold, profile.Chapters.MinSpacing, duration)
+		if err := p.DB.CreateChaptersIfNone(ctx, videoId, chaptersFromStarts(starts)); err != nil {
+			return fmt.Errorf("failed to record chapters: %w", err)
+		}
+		logger.Info("Chapter detection complete", slog.String("video_id", videoId), slog.Int("count", len(starts)))
+	}
+
+	// The source upload is kept, so the video can be clipped or reprocessed later
+	logger.Info("Video processing complete", slog.String("video_id", videoId))
 
 	return nil
 }
 
 func (p *Processor) downloadVideo(videoId, inputDir string) error {
 	videoData, _, _ := p.Storage.Retrieve(videoId)
+	if videoData == nil {
+		return fmt.Errorf("failed to retrieve video %s from storage", videoId)
+	}
 	defer videoData.Close()
 
 	if err := os.MkdirAll(inputDir, 0755); err != nil {
@@ -90,21 +286,55 @@ func (p *Processor) downloadVideo(videoId, inputDir string) error {
 	return nil
 }
 
-func (p *Processor) uploadFile(path string) error {
-	file, err := os.Open(path)
+// Uploads a generated file, using its path relative to the working directory,
+// prefixed with the video ID, as the blob name.
+func (p *Processor) uploadFile(videoId, baseDir, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rel, err := filepath.Rel(baseDir, filePath)
 	if err != nil {
 		return err
 	}
+
+	if p.Storage.Upload(file, BlobName(videoId, filepath.ToSlash(rel))) == "" {
+		return fmt.Errorf("upload failed")
+	}
+	return nil
+}
+
+// Returns the storage name for a file belonging to a processed video.
+func BlobName(videoId, name string) string {
+	return path.Join(videoId, name)
+}
+
+// Fetches the watermark image from storage into the input directory, so it isn't
+// uploaded alongside the generated files.
+func (p *Processor) downloadWatermark(name, inputDir string) error {
+	data, _, _ := p.Storage.Retrieve(name)
+	if data == nil {
+		return fmt.Errorf("failed to retrieve watermark %s from storage", name)
+	}
+	defer data.Close()
+
+	file, err := os.Create(filepath.Join(inputDir, watermarkFileName))
+	if err != nil {
+		return fmt.Errorf("failed to create watermark file: %w", err)
+	}
 	defer file.Close()
 
-	// The file name is used as the blob name
-	p.Storage.Upload(file, filepath.Base(path))
+	if _, err := io.Copy(file, data); err != nil {
+		return fmt.Errorf("failed to copy watermark to temp file: %w", err)
+	}
 	return nil
 }
 
-func (p *Processor) cleanup(dir string) {
+func (p *Processor) cleanup(ctx context.Context, dir string) {
 	if err := os.RemoveAll(dir); err != nil {
-		slog.Error("Failed to delete temp files", slog.String("error", err.Error()))
+		logging.FromContext(ctx).Error("Failed to delete temp files", slog.String("error", err.Error()))
 	}
 }
 
@@ -135,38 +365,87 @@ func (p *Processor) getFilePaths(dirPath string) ([]string, error) {
 	return filePaths, nil
 }
 
-// Given an ID and the video data, creates an m3u8 playlist.
-// Returns a list of strings containing the filenames
-func (p *Processor) generateM3U8(videoId, videoPath, baseDir string) error {
-	hlsPlaylistName := "playlist.m3u8"
+// Runs the first loudnorm pass and records the source loudness against the video.
+// Returns the audio filter that applies the normalization during transcoding, or an
+// empty string if there's nothing to normalize.
+func (p *Processor) normalizeLoudness(ctx context.Context, videoId, inputPath string, settings LoudnessSettings) (string, error) {
+	logger := logging.FromContext(ctx)
+
+	m, err := measureLoudness(ctx, inputPath, settings)
+	if err != nil {
+		return "", err
+	}
+	if m == nil {
+		logger.Info("No audio stream to normalize", slog.String("video_id", videoId))
+		return "", nil
+	}
+	// Digital silence measures as -inf, and can't be normalized
+	if math.IsInf(m.InputI, 0) || math.IsInf(m.InputTP, 0) {
+		logger.Info("Audio is silent, skipping normalization", slog.String("video_id", videoId))
+		return "", nil
+	}
+
+	logger.Info("Measured loudness",
+		slog.String("video_id", videoId),
+		slog.Float64("integrated", m.InputI),
+		slog.Float64("true_peak", m.InputTP))
+
+	if err := p.DB.SetVideoLoudness(ctx, videoId, m.InputI, m.InputTP); err != nil {
+		return "", err
+	}
+
+	return loudnormFilter(settings, m), nil
+}
+
+// Transcodes the video at videoPath into an HLS playlist and segments in baseDir,
+// using the given profile. audioFilter is applied to the audio stream if set.
+// FFmpeg is killed if ctx is cancelled.
+func (p *Processor) generateM3U8(ctx context.Context, profile Profile, info streamInfo, videoPath, baseDir, audioFilter string) error {
+	logger := logging.FromContext(ctx)
+
 	hlsSegmentName := "segment_%03d.ts" // FFMpeg will replace %03d with a number
 
 	var args = []string{
+		"-noautorotate", // Rotation is handled in the filter graph
 		"-i", videoPath, // Input file
-		"-g", "60", // Split keyframes every 60 frames
+	}
+	if profile.Watermark.Image != "" {
+		args = append(args, "-i", filepath.Join(baseDir, "input", watermarkFileName)) // Watermark image
+	}
+	args = append(args,
+		"-filter_complex", videoFilterGraph(profile, info), // Normalization, scaling and any overlays
+		"-map", filterOutputLabel, // Filtered video
+		"-map", "0:a:0?", // First source audio stream, if there is one
+		"-g", strconv.Itoa(profile.GOP), // Keyframe interval in frames
 		"-codec:v", "h264", // Video codec
-		"-preset", "veryfast", // Encoding preset (balance speed/quality)
-		"-b:v", "1M", // Video bitrate (e.g., 1 Mbps)
-		"-maxrate", "1.2M", // Max video bitrate
-		"-bufsize", "1.8M", // Buffer size
-		"-vf", "scale=-2:720", // Scale to 720p, maintain aspect ratio
+		"-preset", profile.Preset, // Encoding preset (balance speed/quality)
+		"-b:v", strconv.Itoa(profile.VideoBitrate), // Video bitrate
+		"-maxrate", strconv.Itoa(profile.MaxRate), // Max video bitrate
+		"-bufsize", strconv.Itoa(profile.BufSize), // Buffer size
 		"-codec:a", "aac", // Audio codec
-		"-b:a", "128k", // Audio bitrate
+		"-b:a", strconv.Itoa(profile.AudioBitrate), // Audio bitrate
+	)
+	if audioFilter != "" {
+		// loudnorm upsamples internally, so bring the output back to a standard rate
+		args = append(args, "-af", audioFilter, "-ar", "48000")
+	}
+	args = append(args,
 		"-f", "hls", // Output format HLS
-		"-hls_time", "2", // Segment duration in seconds
+		"-hls_time", strconv.Itoa(profile.SegmentSeconds), // Segment duration in seconds
 		"-hls_playlist_type", "vod", // VOD for on-demand playback
 		"-hls_segment_filename", filepath.Join(baseDir, hlsSegmentName), // Path for segments
 		filepath.Join(baseDir, hlsPlaylistName), // Path for the main HLS playlist
-	}
+	)
 
-	slog.Info("Running FFmpeg with args", slog.String("args", fmt.Sprintf("%v", args)))
+	logger.Info("Running FFmpeg with args", slog.String("args", fmt.Sprintf("%v", args)))
 
-	cmd := exec.Command("ffmpeg", args...)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
 
 	// Capture combined output for logging on error
 	output, err := cmd.CombinedOutput()
+	observeExit("ffmpeg", err)
 	if err != nil {
-		slog.Error("FFmpeg failed", slog.String("output", string(output)), slog.String("error", err.Error()))
+		logger.Error("FFmpeg failed", slog.String("output", string(output)), slog.String("error", err.Error()))
 		return fmt.Errorf("FFmpeg failed: %w", err)
 	}
 
@@ -0,0 +1,220 @@
+package video
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+const DefaultProfileName = "default"
+
+// Profile holds the encoding settings used when transcoding a video.
+type Profile struct {
+	Name   string `json:"name"`
+	Height int    `json:"height"`
+	// Output aspect ratio such as "16:9". Sources with a different aspect are
+	// letterboxed or pillarboxed to fit. Empty keeps the source's aspect ratio.
+	AspectRatio    string            `json:"aspect_ratio"`
+	Preset         string            `json:"preset"`
+	GOP            int               `json:"gop"`
+	VideoBitrate   int               `json:"video_bitrate"`
+	MaxRate        int               `json:"max_rate"`
+	BufSize        int               `json:"buf_size"`
+	AudioBitrate   int               `json:"audio_bitrate"`
+	SegmentSeconds int               `json:"segment_seconds"`
+	Loudness       LoudnessSettings  `json:"loudness"`
+	AudioOnly      AudioOnlySettings `json:"audio_only"`
+	Watermark      WatermarkSettings `json:"watermark"`
+	Preview        PreviewSettings   `json:"preview"`
+	Chapters       ChapterSettings   `json:"chapters"`
+}
+
+// LoudnessSettings controls EBU R128 loudness normalization of the audio track.
+type LoudnessSettings struct {
+	Enabled bool `json:"enabled"`
+	// Integrated loudness target, in LUFS
+	TargetLUFS float64 `json:"target_lufs"`
+	// Maximum true peak, in dBTP
+	TruePeak float64 `json:"true_peak"`
+	// Loudness range target, in LU
+	LRA float64 `json:"lra"`
+}
+
+// AudioOnlySettings controls the optional audio-only HLS rendition and the
+// standalone audio file offered for download.
+type AudioOnlySettings struct {
+	Enabled bool `json:"enabled"`
+	Bitrate int  `json:"bitrate"`
+	// Either "m4a" or "mp3"
+	DownloadFormat string `json:"download_format"`
+}
+
+// WatermarkSettings controls an image burnt into every video rendition. Giving
+// each tenant or syndication partner their own profile gives them their own branding.
+type WatermarkSettings struct {
+	// Storage name of the image, usually a PNG with transparency. No watermark is applied if empty.
+	Image string `json:"image"`
+	// One of "top-left", "top-right", "bottom-left", "bottom-right" or "center"
+	Position string `json:"position"`
+	// Height of the watermark as a fraction of the video height
+	Scale float64 `json:"scale"`
+	// From 0 (invisible) to 1 (fully opaque)
+	Opacity float64 `json:"opacity"`
+	// Distance from the edges of the video, in pixels
+	Margin int `json:"margin"`
+}
+
+// PreviewSettings controls the short animated preview shown when hovering over
+// a video in a listing.
+type PreviewSettings struct {
+	Enabled bool `json:"enabled"`
+	// Either "webp" or "gif"
+	Format string `json:"format"`
+	// Length of the preview, in seconds
+	Duration float64 `json:"duration"`
+	FPS      int     `json:"fps"`
+	// Width in pixels, with the height following the aspect ratio
+	Width int `json:"width"`
+}
+
+// ChapterSettings controls automatic chapter detection from scene changes.
+type ChapterSettings struct {
+	Enabled bool `json:"enabled"`
+	// Scene change score, from 0 to 1, a frame needs to start a new chapter
+	Threshold float64 `json:"threshold"`
+	// Minimum length of a chapter, in seconds
+	MinSpacing float64 `json:"min_spacing"`
+}
+
+// The settings used for any video that doesn't ask for a specific profile.
+var defaultProfile = Profile{
+	Name:           DefaultProfileName,
+	Height:         720,
+	Preset:         "veryfast",
+	GOP:            60,
+	VideoBitrate:   1_000_000,
+	MaxRate:        1_200_000,
+	BufSize:        1_800_000,
+	AudioBitrate:   128_000,
+	SegmentSeconds: 2,
+	Loudness: LoudnessSettings{
+		TargetLUFS: -16,
+		TruePeak:   -1.5,
+		LRA:        11,
+	},
+	AudioOnly: AudioOnlySettings{
+		Bitrate:        64_000,
+		DownloadFormat: "m4a",
+	},
+	Watermark: WatermarkSettings{
+		Position: "bottom-right",
+		Scale:    0.1,
+		Opacity:  0.8,
+		Margin:   16,
+	},
+	Preview: PreviewSettings{
+		Enabled:  true,
+		Format:   "webp",
+		Duration: 3,
+		FPS:      10,
+		Width:    320,
+	},
+	Chapters: ChapterSettings{
+		Enabled:    true,
+		Threshold:  0.4,
+		MinSpacing: 60,
+	},
+}
+
+// Loads encoding profiles from a JSON file containing an array of profiles.
+// Fields left out of a profile fall back to the default profile's values.
+// If path is empty, only the built-in default profile is available.
+func LoadProfiles(path string) (map[string]Profile, error) {
+	profiles := map[string]Profile{DefaultProfileName: defaultProfile}
+	if path == "" {
+		return profiles, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles file %s: %w", path, err)
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles file %s: %w", path, err)
+	}
+
+	for _, r := range raw {
+		p := defaultProfile
+		if err := json.Unmarshal(r, &p); err != nil {
+			return nil, fmt.Errorf("failed to parse profile: %w", err)
+		}
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("invalid profile %q: %w", p.Name, err)
+		}
+		profiles[p.Name] = p
+	}
+
+	return profiles, nil
+}
+
+func (p Profile) validate() error {
+	switch {
+	case p.Name == "":
+		return fmt.Errorf("name is required")
+	case p.Height <= 0 || p.Height%2 != 0:
+		return fmt.Errorf("height must be a positive even number")
+	case p.AspectRatio != "" && !validAspectRatio(p.AspectRatio):
+		return fmt.Errorf("aspect_ratio must be in the form W:H")
+	case p.VideoBitrate <= 0 || p.MaxRate < p.VideoBitrate || p.BufSize <= 0:
+		return fmt.Errorf("bitrates must be positive, with max_rate at least video_bitrate")
+	case p.AudioBitrate <= 0:
+		return fmt.Errorf("audio_bitrate must be positive")
+	case p.GOP <= 0 || p.SegmentSeconds <= 0:
+		return fmt.Errorf("gop and segment_seconds must be positive")
+	case p.Loudness.Enabled && (p.Loudness.TargetLUFS < -70 || p.Loudness.TargetLUFS > -5):
+		return fmt.Errorf("loudness target_lufs must be between -70 and -5")
+	case p.Loudness.Enabled && (p.Loudness.TruePeak < -9 || p.Loudness.TruePeak > 0):
+		return fmt.Errorf("loudness true_peak must be between -9 and 0")
+	case p.Loudness.Enabled && (p.Loudness.LRA < 1 || p.Loudness.LRA > 50):
+		return fmt.Errorf("loudness lra must be between 1 and 50")
+	case p.AudioOnly.Enabled && p.AudioOnly.Bitrate <= 0:
+		return fmt.Errorf("audio_only bitrate must be positive")
+	case p.AudioOnly.Enabled && p.AudioOnly.DownloadFormat != "m4a" && p.AudioOnly.DownloadFormat != "mp3":
+		return fmt.Errorf("audio_only download_format must be m4a or mp3")
+	case p.Watermark.Image != "" && !slices.Contains(watermarkPositions, p.Watermark.Position):
+		return fmt.Errorf("watermark position must be one of %v", watermarkPositions)
+	case p.Watermark.Image != "" && (p.Watermark.Scale <= 0 || p.Watermark.Scale > 1):
+		return fmt.Errorf("watermark scale must be greater than 0 and at most 1")
+	case p.Watermark.Image != "" && (p.Watermark.Opacity < 0 || p.Watermark.Opacity > 1):
+		return fmt.Errorf("watermark opacity must be between 0 and 1")
+	case p.Watermark.Image != "" && p.Watermark.Margin < 0:
+		return fmt.Errorf("watermark margin must not be negative")
+	case p.Preview.Enabled && p.Preview.Format != "webp" && p.Preview.Format != "gif":
+		return fmt.Errorf("preview format must be webp or gif")
+	case p.Preview.Enabled && (p.Preview.Duration <= 0 || p.Preview.FPS <= 0 || p.Preview.Width <= 0):
+		return fmt.Errorf("preview duration, fps and width must be positive")
+	case p.Chapters.Enabled && (p.Chapters.Threshold <= 0 || p.Chapters.Threshold > 1):
+		return fmt.Errorf("chapters threshold must be greater than 0 and at most 1")
+	case p.Chapters.Enabled && p.Chapters.MinSpacing <= 0:
+		return fmt.Errorf("chapters min_spacing must be positive")
+	}
+	return nil
+}
+
+// The rendition name, e.g. "720p".
+func (p Profile) RenditionName() string {
+	return fmt.Sprintf("%dp", p.Height)
+}
+
+// The peak bandwidth of the rendition, as advertised in the master playlist.
+func (p Profile) Bandwidth() int {
+	return p.MaxRate + p.AudioBitrate
+}
+
+func validAspectRatio(s string) bool {
+	_, err := parseAspectRatio(s)
+	return err == nil
+}
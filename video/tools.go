@@ -0,0 +1,40 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+
+	"github.com/dantdj/goreel/metrics"
+)
+
+// Records the exit code of an FFmpeg or FFprobe run, given the error it
+// returned. Runs that never started, such as when the binary is missing, are
+// recorded with code -1.
+func observeExit(tool string, err error) {
+	code := 0
+	if err != nil {
+		code = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		}
+	}
+	metrics.ToolExits.WithLabelValues(tool, strconv.Itoa(code)).Inc()
+}
+
+// Returns the version line from a tool's -version output, such as
+// "ffmpeg version 7.1", checking that it's installed and runs.
+func ToolVersion(ctx context.Context, tool string) (string, error) {
+	output, err := exec.CommandContext(ctx, tool, "-version").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run %s: %w", tool, err)
+	}
+
+	line, _, _ := bytes.Cut(output, []byte("\n"))
+	line, _, _ = bytes.Cut(line, []byte(" Copyright"))
+	return string(bytes.TrimSpace(line)), nil
+}